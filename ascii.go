@@ -0,0 +1,118 @@
+package main
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// transliterations are the ASCII replacements for characters that aren't letters with accents.
+var transliterations = map[rune]string{
+	// quotes, dashes and other punctuation
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'", '‹': "<", '›': ">",
+	'“': `"`, '”': `"`, '„': `"`, '‟': `"`, '″': `"`, '«': "<<", '»': ">>",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "--", '―': "--", '−': "-",
+	'…': "...", '•': "*", '·': ".", '¡': "!", '¿': "?", '§': "S", '¶': "P",
+	'\u00a0': " ", '\u2007': " ", '\u202f': " ", '\u2009': " ",
+	// letters without decomposition
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'Ä': "Ae", 'Ö': "Oe", 'Ü': "Ue", 'ß': "ss", 'ẞ': "SS",
+	'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O", 'ð': "d", 'Ð': "D",
+	'þ': "th", 'Þ': "Th", 'ł': "l", 'Ł': "L", 'đ': "d", 'Đ': "D", 'ı': "i",
+	// symbols
+	'€': "EUR", '£': "GBP", '¥': "JPY", '©': "(c)", '®': "(R)", '™': "(TM)", '°': "deg",
+	'×': "x", '÷': "/", '±': "+/-", '½': "1/2", '¼': "1/4", '¾': "3/4", '→': "->", '←': "<-",
+	'⇒': "=>", '≤': "<=", '≥': ">=", '≠': "!=", '☐': "[ ]", '☑': "[x]", '☒': "[x]", '✓': "v", '✔': "v",
+	// emoji
+	'😀': ":grinning:", '😃': ":smiley:", '😄': ":smile:", '😁': ":grin:", '😂': ":joy:", '🙂': ":slightly_smiling_face:",
+	'😉': ":wink:", '😊': ":blush:", '😍': ":heart_eyes:", '😎': ":sunglasses:", '😢': ":cry:", '😭': ":sob:",
+	'😮': ":open_mouth:", '😱': ":scream:", '😡': ":rage:", '🤔': ":thinking:", '🙃': ":upside_down_face:",
+	'👍': ":+1:", '👎': ":-1:", '👋': ":wave:", '👏': ":clap:", '🙏': ":pray:", '💪': ":muscle:",
+	'❤': ":heart:", '💔': ":broken_heart:", '⭐': ":star:", '✨': ":sparkles:", '🔥': ":fire:", '🎉': ":tada:",
+	'🚀': ":rocket:", '☕': ":coffee:", '🍺': ":beer:", '🌈': ":rainbow:", '🦄': ":unicorn:", '🧞': ":genie:",
+	'🎵': ":musical_note:", '🎶': ":notes:", '🛠': ":hammer_and_wrench:", '🔧': ":wrench:", '🐛': ":bug:",
+	'📝': ":memo:", '💡': ":bulb:", '📌': ":pushpin:", '🔗': ":link:", '✅': ":white_check_mark:", '❌': ":x:",
+	'⚠': ":warning:", '❓': ":question:", '❗': ":exclamation:", '👀': ":eyes:", '🐈': ":cat2:", '🐕': ":dog2:",
+	'🌱': ":seedling:", '🌍': ":earth_africa:", '☀': ":sunny:", '🌙': ":crescent_moon:", '🏠': ":house:",
+}
+
+// boxDrawing are the ASCII replacements for the lines of box drawing characters. All other box drawing characters
+// are corners or crossings and turn into "+".
+var boxDrawing = map[rune]string{
+	'─': "-", '━': "-", '┄': "-", '┅': "-", '┈': "-", '┉': "-", '╌': "-", '╍': "-", '═': "=",
+	'│': "|", '┃': "|", '┆': "|", '┇': "|", '┊': "|", '┋': "|", '╎': "|", '╏': "|", '║': "|",
+}
+
+// asciiCharacters are the printable ASCII characters.
+const asciiCharacters = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+
+// ascii returns the text using ASCII characters only. Letters with accents lose them, German umlauts are written
+// with an "e", emoji are written as their short codes and the lines of tables are drawn with "-", "|" and "+".
+// Invisible characters are dropped, except for soft hyphens, which the Wrapper handles. Anything else is a "?".
+func ascii(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFC.String(text) {
+		switch s, ok := transliterations[r]; {
+		case r <= unicode.MaxASCII || string(r) == softHyphen:
+			b.WriteRune(r)
+		case ok:
+			b.WriteString(s)
+		case r >= '─' && r <= '╿':
+			if s, ok := boxDrawing[r]; ok {
+				b.WriteString(s)
+			} else {
+				b.WriteString("+")
+			}
+		case runeWidth(r) == 0:
+			// combining marks, joiners, variation selectors and other invisible characters
+		default:
+			// letters with accents, ligatures, superscripts and the like decompose into ASCII and combining marks
+			base := strings.Map(func(r rune) rune {
+				if runeWidth(r) == 0 {
+					return -1
+				}
+				return r
+			}, norm.NFKD.String(string(r)))
+			if base != "" && strings.Trim(base, asciiCharacters) == "" {
+				b.WriteString(base)
+			} else {
+				b.WriteString("?")
+			}
+		}
+	}
+	return b.String()
+}
+
+// transliterate returns the text using only characters the charset can encode. The others are transliterated to
+// ASCII.
+func transliterate(text, charset string) string {
+	if charset == UTF8 || charset == "" {
+		return text
+	}
+	var b strings.Builder
+	for _, r := range norm.NFC.String(text) {
+		if encodable(r, charset) {
+			b.WriteRune(r)
+		} else {
+			b.WriteString(ascii(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// transliterate returns the options with all the strings that are written transliterated for the charset. Tables are
+// drawn with ASCII characters unless the charset has box drawing characters. Deleted text cannot be struck through.
+func (opts Options) transliterate() Options {
+	for _, s := range []*string{&opts.Bullet, &opts.Numbering, &opts.Rule, &opts.MajorUnderline,
+		&opts.MinorUnderline, &opts.Unchecked, &opts.Checked, &opts.TOCTitle, &opts.Term, &opts.FootnoteMarker,
+		&opts.NotesTitle, &opts.CodeFence, &opts.CodeTruncated, &opts.CodeContinued, &opts.Emphasis, &opts.Strong,
+		&opts.Deleted, &opts.InlineCode} {
+		*s = transliterate(*s, opts.Charset)
+	}
+	if opts.TableStyle == Unicode && !encodable('┼', opts.Charset) {
+		opts.TableStyle = ASCII
+	}
+	if opts.Deleted == Strike {
+		opts.Deleted = "~"
+	}
+	return opts
+}
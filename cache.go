@@ -0,0 +1,146 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cacheKey identifies a rendered page. The modification time and the size are part of the key so that a changed file
+// never results in a cache hit, even if the change notification got lost.
+type cacheKey struct {
+	path    string // the path of the Markdown file
+	variant string // the rendering variant
+	mtime   time.Time
+	size    int64
+}
+
+// entryShare is the share of the budget a single entry may use: a page bigger than the budget divided by entryShare is
+// not cached. This limits the memory used by the copies kept while pages are rendered, and a big page never evicts
+// all the other pages.
+const entryShare = 8
+
+// cacheEntry is the value stored in the list of the cache.
+type cacheEntry struct {
+	key     cacheKey
+	content []byte
+}
+
+// Cache is an in-memory LRU cache for rendered pages with a byte budget. It is safe for concurrent use.
+type Cache struct {
+	mu     sync.Mutex
+	max    int                          // max number of bytes to keep
+	used   int                          // number of bytes kept
+	ll     *list.List                   // most recently used entries at the front
+	items  map[cacheKey]*list.Element   // the list elements by key
+	paths  map[string]map[cacheKey]bool // the keys by path, for invalidation
+	hits   uint64
+	misses uint64
+}
+
+// CacheStats are the counters of a cache.
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Bytes   int
+}
+
+// NewCache returns a new cache holding up to max bytes of rendered content. If max is zero, nothing is cached.
+func NewCache(max int) *Cache {
+	return &Cache{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element),
+		paths: make(map[string]map[cacheKey]bool),
+	}
+}
+
+// Get returns the content for the key, if cached, and counts the hit or miss.
+func (c *Cache) Get(key cacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		c.hits++
+		return e.Value.(*cacheEntry).content, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// Put adds the content for the key. Content larger than the limit for entries is not cached. The least recently used
+// entries are evicted until the content fits.
+func (c *Cache) Put(key cacheKey, content []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(content) > c.max/entryShare {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+	for c.used+len(content) > c.max {
+		c.remove(c.ll.Back())
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, content: content})
+	if c.paths[key.path] == nil {
+		c.paths[key.path] = make(map[cacheKey]bool)
+	}
+	c.paths[key.path][key] = true
+	c.used += len(content)
+}
+
+// Invalidate removes all the entries for a path, regardless of variant, modification time or size.
+func (c *Cache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.paths[path] {
+		c.remove(c.items[key])
+	}
+}
+
+// Clear removes all entries. The counters are kept.
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[cacheKey]*list.Element)
+	c.paths = make(map[string]map[cacheKey]bool)
+	c.used = 0
+}
+
+// Resize changes the number of bytes to keep, evicting the least recently used entries if necessary.
+func (c *Cache) Resize(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+	for c.used > c.max {
+		c.remove(c.ll.Back())
+	}
+}
+
+// MaxEntry returns the number of bytes a single entry may use.
+func (c *Cache) MaxEntry() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max / entryShare
+}
+
+// Stats returns the current counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.ll.Len(), Bytes: c.used}
+}
+
+// remove removes a list element. The caller must hold the lock.
+func (c *Cache) remove(e *list.Element) {
+	entry := c.ll.Remove(e).(*cacheEntry)
+	delete(c.items, entry.key)
+	delete(c.paths[entry.key.path], entry.key)
+	if len(c.paths[entry.key.path]) == 0 {
+		delete(c.paths, entry.key.path)
+	}
+	c.used -= len(entry.content)
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// watchMask are the inotify events that invalidate cache entries.
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// watch uses inotify to invalidate the cache entries of files in the directory tree starting at root whenever they
+// change. New subdirectories are watched as they appear. Directories starting with a dot are skipped.
+func (c *Cache) watch(root string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	dirs := make(map[int32]string)
+	add := func(dir string) {
+		filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			wd, err := syscall.InotifyAddWatch(fd, p, watchMask)
+			if err != nil {
+				log.Println(err)
+				return nil
+			}
+			dirs[int32(wd)] = p
+			return nil
+		})
+	}
+	add(root)
+	go func() {
+		buf := make([]byte, 16*1024)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if err != nil {
+				log.Println(err)
+				syscall.Close(fd)
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				start := offset + syscall.SizeofInotifyEvent
+				offset = start + int(ev.Len)
+				if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+					c.Clear()
+					continue
+				}
+				dir, ok := dirs[ev.Wd]
+				if !ok {
+					continue
+				}
+				if ev.Mask&syscall.IN_IGNORED != 0 {
+					delete(dirs, ev.Wd)
+					continue
+				}
+				p := filepath.Join(dir, string(bytes.TrimRight(buf[start:offset], "\x00")))
+				if ev.Mask&syscall.IN_ISDIR != 0 {
+					if ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+						add(p)
+					}
+					continue
+				}
+				c.Invalidate(p)
+			}
+		}
+	}()
+	return nil
+}
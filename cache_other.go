@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// watch does nothing on systems without inotify. Since the modification time and the size of a file are part of the
+// cache key, changed files are still rendered again.
+func (c *Cache) watch(root string) error {
+	return nil
+}
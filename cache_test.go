@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache(32)
+	a := cacheKey{path: "a.md", variant: "text"}
+	b := cacheKey{path: "b.md", variant: "text"}
+	d := cacheKey{path: "d.md", variant: "text"}
+	c.Put(a, []byte("aaaa"))
+	c.Put(b, []byte("bbbb"))
+	for _, p := range []string{"1.md", "2.md", "3.md", "4.md", "5.md", "6.md"} {
+		c.Put(cacheKey{path: p, variant: "text"}, []byte("1234"))
+	}
+	_, ok := c.Get(a) // a is now the most recently used entry
+	assert.True(t, ok)
+	c.Put(d, []byte("dddd"))
+	_, ok = c.Get(b)
+	assert.False(t, ok)
+	content, ok := c.Get(a)
+	assert.True(t, ok)
+	assert.Equal(t, "aaaa", string(content))
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Entries: 8, Bytes: 32}, c.Stats())
+}
+
+func TestCacheTooLarge(t *testing.T) {
+	c := NewCache(3)
+	a := cacheKey{path: "a.md", variant: "text"}
+	c.Put(a, []byte("aaaa"))
+	_, ok := c.Get(a)
+	assert.False(t, ok)
+	// a single entry may only use an eighth of the budget
+	c = NewCache(31)
+	c.Put(a, []byte("aaaa"))
+	_, ok = c.Get(a)
+	assert.False(t, ok)
+}
+
+func TestCacheModified(t *testing.T) {
+	c := NewCache(100)
+	a := cacheKey{path: "a.md", variant: "text", mtime: time.Unix(1, 0), size: 4}
+	c.Put(a, []byte("aaaa"))
+	a.mtime = time.Unix(2, 0)
+	_, ok := c.Get(a)
+	assert.False(t, ok)
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	c := NewCache(100)
+	a := cacheKey{path: "a.md", variant: "text"}
+	b := cacheKey{path: "a.md", variant: "other"}
+	c.Put(a, []byte("aaaa"))
+	c.Put(b, []byte("bbbb"))
+	c.Invalidate("a.md")
+	assert.Equal(t, 0, c.Stats().Entries)
+	assert.Equal(t, 0, c.Stats().Bytes)
+}
+
+func TestCacheWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is only available on Linux")
+	}
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "a.md")
+	assert.NoError(t, os.WriteFile(fp, []byte("# A\n"), 0644))
+	c := NewCache(100)
+	assert.NoError(t, c.watch(dir))
+	c.Put(cacheKey{path: fp, variant: "text"}, []byte("A"))
+	assert.NoError(t, os.WriteFile(fp, []byte("# B\n"), 0644))
+	assert.Eventually(t, func() bool { return c.Stats().Entries == 0 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Charsets for the output.
+const (
+	UTF8    = "utf-8"      // everything as it is
+	USASCII = "us-ascii"   // transliterated to ASCII
+	Latin1  = "iso-8859-1" // Western European characters, the rest transliterated to ASCII
+	CP437   = "cp437"      // the IBM PC character set with box drawing characters, the rest transliterated to ASCII
+)
+
+// Charsets are all the charsets.
+var Charsets = []string{UTF8, USASCII, Latin1, CP437}
+
+// charsetAliases are other names for the Charsets.
+var charsetAliases = map[string]string{
+	"utf8": UTF8, "ascii": USASCII, "latin1": Latin1, "latin-1": Latin1, "iso8859-1": Latin1, "ibm437": CP437,
+}
+
+// charmaps are the single byte encodings of the Charsets.
+var charmaps = map[string]*charmap.Charmap{
+	Latin1: charmap.ISO8859_1,
+	CP437:  charmap.CodePage437,
+}
+
+// charset returns one of the Charsets for a name, ignoring case. The empty name is UTF-8.
+func charset(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return UTF8, true
+	}
+	if alias, ok := charsetAliases[name]; ok {
+		return alias, true
+	}
+	for _, c := range Charsets {
+		if c == name {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// validCharset returns the charset for a name or an error unless it is one of the Charsets or their aliases.
+func validCharset(name string) (string, error) {
+	c, ok := charset(name)
+	if !ok {
+		return "", fmt.Errorf("unknown charset %s, use one of %s", name, strings.Join(Charsets, ", "))
+	}
+	return c, nil
+}
+
+// encodable reports whether the character can be written using the charset.
+func encodable(r rune, charset string) bool {
+	if cm, ok := charmaps[charset]; ok {
+		_, ok = cm.EncodeRune(r)
+		return ok
+	}
+	return charset != USASCII || r <= unicode.MaxASCII
+}
+
+// encoder is a writer that encodes UTF-8 using a charset. Characters that cannot be encoded are written as "?". A
+// character split across writes is kept until the rest of it is written.
+type encoder struct {
+	w       io.Writer
+	charset string
+	rest    []byte // the start of an incomplete character at the end of the last write
+}
+
+// newEncoder returns a writer that encodes the output using the charset, unless it is UTF-8.
+func newEncoder(w io.Writer, charset string) io.Writer {
+	if charset == UTF8 || charset == "" {
+		return w
+	}
+	return &encoder{w: w, charset: charset}
+}
+
+// Write implements io.Writer.
+func (e *encoder) Write(p []byte) (int, error) {
+	b := append(e.rest, p...)
+	n := len(b)
+	start := n - 1
+	for start > 0 && start > n-utf8.UTFMax && !utf8.RuneStart(b[start]) {
+		start--
+	}
+	if start >= 0 && !utf8.FullRune(b[start:]) {
+		n = start
+	}
+	e.rest = append([]byte(nil), b[n:]...)
+	_, err := e.w.Write(encode(b[:n], e.charset))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encode returns the UTF-8 text encoded using the charset. Characters that cannot be encoded are written as "?".
+func encode(p []byte, charset string) []byte {
+	if charset == UTF8 || charset == "" {
+		return p
+	}
+	cm := charmaps[charset]
+	result := make([]byte, 0, len(p))
+	for _, r := range string(p) {
+		switch {
+		case r <= unicode.MaxASCII:
+			result = append(result, byte(r))
+		case cm != nil:
+			if b, ok := cm.EncodeRune(r); ok {
+				result = append(result, b)
+				continue
+			}
+			fallthrough
+		default:
+			result = append(result, '?')
+		}
+	}
+	return result
+}
+
+// readMarkdown reads a Markdown file and returns it as UTF-8. A byte order mark is removed. A file that isn't valid
+// UTF-8 is taken to be Windows-1252, the superset of ISO-8859-1 used by most old files.
+func readMarkdown(fp string) ([]byte, error) {
+	md, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	md = bytes.TrimPrefix(md, []byte("\ufeff"))
+	if !utf8.Valid(md) {
+		md, err = charmap.Windows1252.NewDecoder().Bytes(md)
+	}
+	return md, err
+}
+
+// menuText returns the text of a menu item transliterated and encoded for the charset of the options.
+func menuText(text string, opts Options) string {
+	return string(encode([]byte(transliterate(text, opts.Charset)), opts.Charset))
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEncoderSplitCharacters(t *testing.T) {
+	var b strings.Builder
+	w := newEncoder(&b, Latin1)
+	text := []byte("Café für 5 €")
+	for i := range text {
+		n, err := w.Write(text[i : i+1])
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+	assert.Equal(t, "Caf\xe9 f\xfcr 5 ?", b.String())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"io"
+	"strings"
+)
+
+// Policies for code lines that are longer than the width.
+const (
+	Keep     = "keep"     // keep the line as it is
+	Truncate = "truncate" // cut the line and end it with Options.CodeTruncated
+	Wrap     = "wrap"     // break the line and end all but the last part with Options.CodeContinued
+)
+
+// LongCodePolicies are all the policies for long code lines.
+var LongCodePolicies = []string{Keep, Truncate, Wrap}
+
+// tabWidth is the distance between tab stops in code blocks.
+const tabWidth = 4
+
+// codeBlock writes a code block. The lines are indented but they are never wrapped like the other text. Lines that
+// are too long are handled according to Options.LongCode. If there is a fence, it is written before and after the
+// code, and the language of the code follows the first fence.
+func (r Renderer) codeBlock(w io.Writer, node *ast.CodeBlock) {
+	indent := strings.Repeat(space, r.opts.CodeIndent)
+	if r.opts.CodeFence != "" {
+		info, _, _ := strings.Cut(strings.TrimSpace(string(node.Info)), space)
+		r.buf.writeLine(w, r.opts.CodeFence+info)
+	}
+	text := transliterate(strings.TrimSuffix(string(node.Literal), "\n"), r.opts.Charset)
+	for _, line := range strings.Split(text, "\n") {
+		line = indent + expandTabs(strings.TrimSuffix(line, "\r"))
+		width := r.buf.max - r.buf.prefixWidth()
+		switch {
+		case displayWidth(line) <= width || r.opts.LongCode == Keep:
+			r.buf.writeLine(w, line)
+		case r.opts.LongCode == Truncate:
+			head, _ := cut(line, width-displayWidth(r.opts.CodeTruncated))
+			r.buf.writeLine(w, head+r.opts.CodeTruncated)
+		default:
+			// the indent is dropped if there is no room for the code after it
+			available := width - displayWidth(r.opts.CodeContinued)
+			prefix := indent
+			if available <= displayWidth(indent) {
+				prefix = ""
+				line = strings.TrimPrefix(line, indent)
+			}
+			for displayWidth(line) > width {
+				head, tail := cut(line, available)
+				if len(head) <= len(prefix) {
+					break // not even a single character fits after the indent
+				}
+				r.buf.writeLine(w, head+r.opts.CodeContinued)
+				line = prefix + tail
+			}
+			r.buf.writeLine(w, line)
+		}
+	}
+	if r.opts.CodeFence != "" {
+		r.buf.writeLine(w, r.opts.CodeFence)
+	}
+}
+
+// expandTabs replaces the tabs in a line with spaces up to the next tab stop.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := tabWidth - column%tabWidth
+			b.WriteString(strings.Repeat(space, n))
+			column += n
+		} else {
+			b.WriteRune(r)
+			column += runeWidth(r)
+		}
+	}
+	return b.String()
+}
+
+// validLongCode returns an error unless the policy is one of the LongCodePolicies.
+func validLongCode(policy string) error {
+	for _, p := range LongCodePolicies {
+		if p == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %s, use one of %s", policy, strings.Join(LongCodePolicies, ", "))
+}
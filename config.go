@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultCacheSize is the number of bytes of rendered pages kept in memory unless configured otherwise. The systemd
+// unit limits the memory to 20M.
+const defaultCacheSize = 5 << 20
+
+// defaultMinWidth and defaultMaxWidth limit the width a client may ask for unless configured otherwise.
+const (
+	defaultMinWidth = 20
+	defaultMaxWidth = 200
+)
+
+// Config holds the settings of the server. The environment variables provide the defaults and the config file named
+// by GOPHER_CONFIG, if any, overrides them.
+type Config struct {
+	Host      string // GOPHER_HOST or "host"
+	Port      string // GOPHER_PORT or "port"
+	CacheSize int    // GOPHER_CACHE_SIZE or "cache-size", in bytes
+	Metrics   string // GOPHER_METRICS or "metrics", the address for Prometheus
+	Log       string // GOPHER_LOG or "log", the log file; empty for standard error
+	Sites     []*Site
+}
+
+// loadConfig returns the configuration from the environment and the config file. The config file consists of lines
+// with a key, an equals sign and a value. Empty lines and lines starting with "#" are ignored. A line such as "[site
+// name]" starts a site definition. If there are no site definitions, the current directory is served using the host
+// and port.
+func loadConfig() (*Config, error) {
+	config := &Config{
+		Host:      "localhost",
+		Port:      "70",
+		CacheSize: defaultCacheSize,
+	}
+	settings := map[string]string{
+		"host":       os.Getenv("GOPHER_HOST"),
+		"port":       os.Getenv("GOPHER_PORT"),
+		"cache-size": os.Getenv("GOPHER_CACHE_SIZE"),
+		"metrics":    os.Getenv("GOPHER_METRICS"),
+		"log":        os.Getenv("GOPHER_LOG"),
+	}
+	if path := os.Getenv("GOPHER_CONFIG"); path != "" {
+		sites, err := readConfig(path, settings)
+		if err != nil {
+			return nil, err
+		}
+		config.Sites = sites
+	}
+	for key, value := range settings {
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "host":
+			config.Host = value
+		case "port":
+			config.Port = value
+		case "cache-size":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("cache-size: %w", err)
+			}
+			config.CacheSize = n
+		case "metrics":
+			config.Metrics = value
+		case "log":
+			config.Log = value
+		}
+	}
+	if len(config.Sites) == 0 {
+		config.Sites = []*Site{{
+			Name:     "default",
+			Root:     ".",
+			Host:     config.Host,
+			Listen:   []string{net.JoinHostPort(config.Host, config.Port)},
+			Options:  DefaultOptions(),
+			MinWidth: defaultMinWidth,
+			MaxWidth: defaultMaxWidth,
+		}}
+	}
+	for _, site := range config.Sites {
+		if site.Host == "" {
+			site.Host = config.Host
+		}
+		if site.MinWidth > site.MaxWidth {
+			return nil, fmt.Errorf("site %s: min-width is larger than max-width", site.Name)
+		}
+		err := site.init()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// readConfig reads the config file, stores the settings found and returns the sites defined. Unknown keys are an
+// error.
+func readConfig(path string, settings map[string]string) ([]*Site, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sites []*Site
+	var site *Site
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name, ok := strings.CutPrefix(line[1:len(line)-1], "site ")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("%s:%d: expected [site name]", path, n)
+			}
+			site = &Site{Name: name, Options: DefaultOptions(), MinWidth: defaultMinWidth, MaxWidth: defaultMaxWidth}
+			sites = append(sites, site)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if site != nil {
+			err = site.set(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			continue
+		}
+		if _, ok := settings[key]; !ok {
+			return nil, fmt.Errorf("%s:%d: unknown key %s", path, n, key)
+		}
+		settings[key] = value
+	}
+	return sites, scanner.Err()
+}
+
+// set changes a setting of a site. The listen key may be used multiple times and each value may contain multiple
+// addresses separated by whitespace. The other keys set the rendering options.
+func (site *Site) set(key, value string) error {
+	var err error
+	switch key {
+	case "root":
+		site.Root = value
+	case "host":
+		site.Host = value
+	case "listen":
+		site.Listen = append(site.Listen, strings.Fields(value)...)
+	case "width":
+		var width int
+		width, err = positive(value)
+		site.Options = site.Options.WithWidth(width)
+		// an explicit rule length is the length at the configured width, whether it comes first or not
+		if site.ruleLength > 0 {
+			site.Options.RuleLength = site.ruleLength
+		}
+	case "min-width":
+		site.MinWidth, err = positive(value)
+	case "max-width":
+		site.MaxWidth, err = positive(value)
+	case "line-ending":
+		switch value {
+		case "lf":
+			site.Options.Newline = "\n"
+		case "crlf":
+			site.Options.Newline = "\r\n"
+		default:
+			err = fmt.Errorf("line-ending must be lf or crlf, not %s", value)
+		}
+	case "strict":
+		site.Strict, err = strconv.ParseBool(value)
+	case "bullet":
+		site.Options.Bullet = value
+	case "numbering":
+		if !strings.Contains(value, "%d") {
+			err = fmt.Errorf("numbering must contain %%d, not %s", value)
+		}
+		site.Options.Numbering = value
+	case "number-styles":
+		err = validNumberStyles(value)
+		site.Options.NumberStyles = value
+	case "unchecked":
+		site.Options.Unchecked = value
+	case "checked":
+		site.Options.Checked = value
+	case "rule":
+		site.Options.Rule = value
+	case "rule-length":
+		site.ruleLength, err = positive(value)
+		site.Options.RuleLength = site.ruleLength
+	case "major-underline":
+		site.Options.MajorUnderline = value
+	case "minor-underline":
+		site.Options.MinorUnderline = value
+	case "heading-style":
+		err = validHeadingStyle(value)
+		for i := range site.Options.Headings {
+			site.Options.Headings[i] = value
+		}
+	case "heading-1-style", "heading-2-style", "heading-3-style", "heading-4-style", "heading-5-style",
+		"heading-6-style":
+		err = validHeadingStyle(value)
+		site.Options.Headings[key[8]-'1'] = value
+	case "numbered-headings":
+		site.Options.NumberHeadings, err = strconv.ParseBool(value)
+	case "toc":
+		site.Options.TOC, err = strconv.Atoi(value)
+	case "toc-title":
+		site.Options.TOCTitle = value
+	case "footnote-marker":
+		if !strings.Contains(value, "%d") {
+			err = fmt.Errorf("footnote-marker must contain %%d, not %s", value)
+		}
+		site.Options.FootnoteMarker = value
+	case "notes-title":
+		site.Options.NotesTitle = value
+	case "code-indent":
+		site.Options.CodeIndent, err = strconv.Atoi(value)
+		if err == nil && site.Options.CodeIndent < 0 {
+			err = fmt.Errorf("code-indent must not be negative")
+		}
+	case "code-fence":
+		site.Options.CodeFence = value
+	case "long-code":
+		err = validLongCode(value)
+		site.Options.LongCode = value
+	case "code-truncated":
+		site.Options.CodeTruncated = value
+	case "code-continued":
+		site.Options.CodeContinued = value
+	case "table-style":
+		err = validTableStyle(value)
+		site.Options.TableStyle = value
+	case "emphasis":
+		site.Options.Emphasis = value
+	case "strong":
+		site.Options.Strong = value
+	case "deleted":
+		site.Options.Deleted = value
+	case "inline-code":
+		site.Options.InlineCode = value
+	case "term":
+		if !strings.Contains(value, "%s") {
+			err = fmt.Errorf("term must contain %%s, not %s", value)
+		}
+		site.Options.Term = value
+	case "definition-indent":
+		site.Options.DefinitionIndent, err = strconv.Atoi(value)
+		if err == nil && site.Options.DefinitionIndent < 0 {
+			err = fmt.Errorf("definition-indent must not be negative")
+		}
+	case "long-words":
+		err = validLongWords(value)
+		site.Options.LongWords = value
+	case "charset":
+		site.Options.Charset, err = validCharset(value)
+	case "ascii":
+		var ascii bool
+		ascii, err = strconv.ParseBool(value)
+		if ascii {
+			site.Options.Charset = USASCII
+		}
+	case "justify":
+		site.Options.Justify, err = strconv.ParseBool(value)
+	case "verse-indent":
+		site.Options.VerseIndent, err = strconv.Atoi(value)
+		if err == nil && site.Options.VerseIndent < 0 {
+			err = fmt.Errorf("verse-indent must not be negative")
+		}
+	case "indent":
+		site.Options.Indent, err = strconv.Atoi(value)
+		if err == nil && site.Options.Indent < 0 {
+			err = fmt.Errorf("indent must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown key %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// positive parses a number greater than zero.
+func positive(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err == nil && n <= 0 {
+		err = fmt.Errorf("%d is not positive", n)
+	}
+	return n, err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "gopher.conf")
+	assert.NoError(t, os.WriteFile(fp, []byte(`# test
+host = example.org
+cache-size = 1000
+`), 0644))
+	t.Setenv("GOPHER_CONFIG", fp)
+	t.Setenv("GOPHER_PORT", "7070")
+	t.Setenv("GOPHER_HOST", "localhost")
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.org", config.Host)
+	assert.Equal(t, "7070", config.Port)
+	assert.Equal(t, 1000, config.CacheSize)
+	assert.Equal(t, 1, len(config.Sites))
+	assert.Equal(t, []string{"example.org:7070"}, config.Sites[0].Listen)
+}
+
+func TestConfigSites(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "gopher.conf")
+	assert.NoError(t, os.WriteFile(fp, []byte(`host = example.org
+[site one]
+root = `+dir+`
+listen = localhost:7070 localhost:7071
+[site two]
+root = `+dir+`
+host = two.example.org
+listen = localhost:7072
+listen = localhost:7073
+`), 0644))
+	t.Setenv("GOPHER_CONFIG", fp)
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(config.Sites))
+	assert.Equal(t, "one", config.Sites[0].Name)
+	assert.Equal(t, "example.org", config.Sites[0].Host)
+	assert.Equal(t, []string{"localhost:7070", "localhost:7071"}, config.Sites[0].Listen)
+	assert.Equal(t, "two.example.org", config.Sites[1].Host)
+	assert.Equal(t, []string{"localhost:7072", "localhost:7073"}, config.Sites[1].Listen)
+}
+
+func TestConfigUnknownKey(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "gopher.conf")
+	assert.NoError(t, os.WriteFile(fp, []byte("colour = blue\n"), 0644))
+	t.Setenv("GOPHER_CONFIG", fp)
+	_, err := loadConfig()
+	assert.ErrorContains(t, err, "unknown key colour")
+}
+
+func TestConfigCharset(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "gopher.conf")
+	assert.NoError(t, os.WriteFile(fp, []byte(`[site one]
+root = `+dir+`
+listen = localhost:7070
+charset = cp437
+ascii = false
+[site two]
+root = `+dir+`
+listen = localhost:7071
+ascii = true
+`), 0644))
+	t.Setenv("GOPHER_CONFIG", fp)
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, CP437, config.Sites[0].Options.Charset)
+	assert.Equal(t, USASCII, config.Sites[1].Options.Charset)
+}
+
+func TestConfigWidth(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "gopher.conf")
+	assert.NoError(t, os.WriteFile(fp, []byte(`[site one]
+root = `+dir+`
+listen = localhost:7070
+width = 40
+[site two]
+root = `+dir+`
+listen = localhost:7071
+rule-length = 30
+width = 40
+[site three]
+root = `+dir+`
+listen = localhost:7072
+width = 40
+rule-length = 30
+`), 0644))
+	t.Setenv("GOPHER_CONFIG", fp)
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	// the rule keeps its distance from the right margin unless its length is set
+	assert.Equal(t, 40, config.Sites[0].Options.Width)
+	assert.Equal(t, 38, config.Sites[0].Options.RuleLength)
+	assert.Equal(t, 58, config.Sites[0].Options.WithWidth(60).RuleLength)
+	assert.Equal(t, 30, config.Sites[1].Options.RuleLength)
+	assert.Equal(t, 30, config.Sites[2].Options.RuleLength)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/net/html"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Heading styles.
+const (
+	Setext    = "setext"    // underlined, see Options.MajorUnderline and Options.MinorUnderline
+	ATX       = "atx"       // prefixed with one "#" per level
+	Uppercase = "uppercase" // all uppercase
+	Boxed     = "boxed"     // surrounded by a box
+)
+
+// HeadingStyles are all the heading styles.
+var HeadingStyles = []string{Setext, ATX, Uppercase, Boxed}
+
+// plainText returns the text of all the leaf nodes below a node, without any markup. HTML entities are decoded.
+func plainText(node ast.Node) string {
+	var b strings.Builder
+	ast.WalkFunc(node, func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); leaf != nil && entering {
+			if _, ok := node.(*ast.Text); ok && isEntity(leaf.Literal) {
+				b.WriteString(html.UnescapeString(string(leaf.Literal)))
+			} else {
+				b.Write(leaf.Literal)
+			}
+		}
+		return ast.GoToNext
+	})
+	return b.String()
+}
+
+// lines wraps the text to the width and returns the lines.
+func lines(text string, width int) []string {
+	var b strings.Builder
+	buf := NewRenderer(DefaultOptions().WithWidth(max(width, 1))).buf
+	buf.writeWords(&b, text)
+	buf.newline(&b)
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// headingID returns the ID of a heading. With the AutoHeadingIDs extension, the parser derives it from the heading
+// text and makes sure it is unique. Otherwise, it is derived the same way here, but it might not be unique.
+func headingID(node *ast.Heading) string {
+	if node.HeadingID != "" {
+		return node.HeadingID
+	}
+	var id []rune
+	dash := false
+	for _, r := range plainText(node) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if dash && len(id) > 0 {
+				id = append(id, '-')
+			}
+			dash = false
+			id = append(id, unicode.ToLower(r))
+		} else {
+			dash = true
+		}
+	}
+	if len(id) == 0 {
+		return "empty"
+	}
+	return string(id)
+}
+
+// initSections collects the headings of the document and numbers them. If the document has a single level 1 heading,
+// it is the title: it is not numbered and it is not part of the table of contents. Otherwise, numbering starts at the
+// highest level used.
+func (r Renderer) initSections(doc ast.Node) {
+	count := make([]int, 7)
+	var headings []*ast.Heading
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering && heading.Level >= 1 && heading.Level <= 6 {
+			count[heading.Level]++
+			headings = append(headings, heading)
+		}
+		return ast.GoToNext
+	})
+	base := 1
+	if count[1] == 1 {
+		base = 2
+	}
+	for base < 6 && count[base] == 0 {
+		base++
+	}
+	r.buf.headings = nil
+	r.buf.numbers = make(map[*ast.Heading]string)
+	var sections [6]int
+	for _, heading := range headings {
+		if heading.Level < base {
+			continue
+		}
+		r.buf.headings = append(r.buf.headings, heading)
+		sections[heading.Level-1]++
+		for i := heading.Level; i < 6; i++ {
+			sections[i] = 0
+		}
+		var parts []string
+		for i := base - 1; i < heading.Level; i++ {
+			parts = append(parts, strconv.Itoa(sections[i]))
+		}
+		r.buf.numbers[heading] = strings.Join(parts, ".")
+	}
+}
+
+// headingText returns the text of the heading, including its section number if sections are numbered.
+func (r Renderer) headingText(node *ast.Heading) string {
+	text := transliterate(strings.Join(fields(plainText(node)), space), r.opts.Charset)
+	if number := r.buf.numbers[node]; r.opts.NumberHeadings && number != "" {
+		text = number + space + text
+	}
+	return text
+}
+
+// heading writes a heading in the style for its level. The heading text is wrapped like any other text.
+func (r Renderer) heading(w io.Writer, node *ast.Heading) {
+	r.writeHeading(w, r.headingText(node), node.Level)
+}
+
+// writeHeading writes the text as a heading in the style for the level.
+func (r Renderer) writeHeading(w io.Writer, text string, level int) {
+	level = min(max(level, 1), 6)
+	style := r.opts.Headings[level-1]
+	width := r.buf.max - r.buf.prefixWidth()
+	var result []string
+	switch style {
+	case ATX:
+		marker := strings.Repeat("#", level) + space
+		indent := strings.Repeat(space, displayWidth(marker))
+		for i, line := range lines(text, width-displayWidth(marker)) {
+			if i == 0 {
+				result = append(result, marker+line)
+			} else {
+				result = append(result, indent+line)
+			}
+		}
+	case Uppercase:
+		result = lines(strings.ToUpper(text), width)
+	case Boxed:
+		result = lines(text, width-4)
+		longest := 0
+		for _, line := range result {
+			longest = max(longest, displayWidth(line))
+		}
+		border := "+" + strings.Repeat("-", longest+2) + "+"
+		for i, line := range result {
+			result[i] = "| " + line + strings.Repeat(space, longest-displayWidth(line)) + " |"
+		}
+		result = append([]string{border}, append(result, border)...)
+	default:
+		result = lines(text, width)
+		longest := 0
+		for _, line := range result {
+			longest = max(longest, displayWidth(line))
+		}
+		s := r.opts.MinorUnderline
+		if level == 1 {
+			s = r.opts.MajorUnderline
+		}
+		if n := displayWidth(s); n > 0 {
+			result = append(result, strings.Repeat(s, (longest+n-1)/n))
+		}
+	}
+	for _, line := range result {
+		r.buf.write(w, line)
+		r.buf.newline(w)
+	}
+}
+
+// validHeadingStyle returns an error unless the style is one of the HeadingStyles.
+func validHeadingStyle(style string) error {
+	for _, s := range HeadingStyles {
+		if s == style {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown heading style %s, use one of %s", style, strings.Join(HeadingStyles, ", "))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"github.com/gomarkdown/markdown/ast"
+	"golang.org/x/net/html"
+	"io"
+	"jaytaylor.com/html2text"
+	"strings"
+)
+
+// isEntity reports whether the text is an HTML entity such as "&eacute;". The parser keeps these as text of their own.
+func isEntity(text []byte) bool {
+	return len(text) > 2 && text[0] == '&' && text[len(text)-1] == ';' && !bytes.ContainsAny(text, " \t\n")
+}
+
+// htmlSpan writes the text equivalent of an inline HTML tag: a line break, the markers for emphasis, deleted text and
+// code, or the expansion of an abbreviation after it. Comments and all other tags are dropped.
+func (r Renderer) htmlSpan(w io.Writer, node *ast.HTMLSpan) {
+	z := html.NewTokenizer(bytes.NewReader(node.Literal))
+	z.Next()
+	token := z.Token()
+	entering := token.Type == html.StartTagToken
+	if !entering && token.Type != html.EndTagToken {
+		if token.Type == html.SelfClosingTagToken && token.Data == "br" {
+			r.lineBreak(w)
+		}
+		return
+	}
+	switch token.Data {
+	case "br":
+		if entering {
+			r.lineBreak(w)
+		}
+	case "em", "i", "cite", "dfn", "var":
+		r.marker(w, r.opts.Emphasis, entering)
+	case "strong", "b":
+		r.strong(w, entering)
+	case "del", "s", "strike":
+		r.deleted(w, entering)
+	case "code", "kbd", "samp", "tt":
+		r.marker(w, r.opts.InlineCode, entering)
+	case "abbr":
+		if entering {
+			title := ""
+			for _, attr := range token.Attr {
+				if attr.Key == "title" {
+					title = strings.Join(fields(attr.Val), space)
+					title = transliterate(title, r.opts.Charset)
+				}
+			}
+			r.buf.abbr = append(r.buf.abbr, title)
+		} else if n := len(r.buf.abbr); n > 0 {
+			if title := r.buf.abbr[n-1]; title != "" {
+				r.buf.writeWords(w, " ("+title+")")
+			}
+			r.buf.abbr = r.buf.abbr[:n-1]
+		}
+	}
+}
+
+// htmlBlock writes the text of an HTML block like a paragraph. Lines are wrapped, except for the lines of tables.
+// Blocks without any text, such as comments, are dropped.
+func (r Renderer) htmlBlock(w io.Writer, node *ast.HTMLBlock) {
+	text, err := html2text.FromReader(bytes.NewReader(node.Literal), html2text.Options{PrettyTables: true})
+	text = strings.Trim(text, "\n")
+	text = transliterate(text, r.opts.Charset)
+	if err != nil || strings.TrimSpace(text) == "" {
+		return
+	}
+	r.paragraphSeparator(w)
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			blank = true
+			continue
+		case blank:
+			r.buf.writeLine(w, "")
+			blank = false
+		}
+		if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "|") {
+			r.buf.writeLine(w, line)
+		} else {
+			r.buf.writeWords(w, line)
+			r.buf.newline(w)
+		}
+	}
+}
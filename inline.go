@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Strike is the marker for deleted text that strikes through every character using a combining character, instead of
+// putting markers around the text.
+const Strike = "strike"
+
+// longStroke is the combining character used to strike through text.
+const longStroke = '\u0336'
+
+// markers returns the markers before and after some inline text. A marker is used on both sides unless it consists of
+// two markers separated by a space, such as "“ ”".
+func markers(marker string) (string, string) {
+	if open, close, ok := strings.Cut(marker, space); ok {
+		return open, close
+	}
+	return marker, marker
+}
+
+// strike adds a combining long stroke overlay to every character that is not whitespace.
+func strike(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteRune(r)
+		if !unicode.IsSpace(r) {
+			b.WriteRune(longStroke)
+		}
+	}
+	return b.String()
+}
+
+// marker writes the marker before or after some inline text. The marker before the text sticks to the first word and
+// the marker after the text sticks to the last word.
+func (r Renderer) marker(w io.Writer, marker string, entering bool) {
+	if marker == "" {
+		return
+	}
+	open, close := markers(marker)
+	if entering {
+		r.buf.writeWords(w, open)
+	} else {
+		r.buf.writeWords(w, close)
+	}
+}
+
+// strong writes the marker for strong emphasis or switches to uppercase.
+func (r Renderer) strong(w io.Writer, entering bool) {
+	if r.opts.Strong == Uppercase {
+		r.buf.upper += count(entering)
+	} else {
+		r.marker(w, r.opts.Strong, entering)
+	}
+}
+
+// deleted writes the marker for deleted text or switches to striking through.
+func (r Renderer) deleted(w io.Writer, entering bool) {
+	if r.opts.Deleted == Strike {
+		r.buf.strike += count(entering)
+	} else {
+		r.marker(w, r.opts.Deleted, entering)
+	}
+}
+
+// inline returns text in uppercase or struck through, depending on the strong emphasis and deleted text it is in.
+func (r Renderer) inline(text string) string {
+	if r.buf.upper > 0 {
+		text = strings.ToUpper(text)
+	}
+	if r.buf.strike > 0 {
+		text = strike(text)
+	}
+	return text
+}
+
+// count returns 1 when entering a node and -1 when leaving it.
+func count(entering bool) int {
+	if entering {
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"strconv"
+	"strings"
+)
+
+// Numbering styles for ordered lists, used in Options.NumberStyles.
+const (
+	Decimal    = '1' // 1, 2, 3, …
+	LowerAlpha = 'a' // a, b, c, …, z, aa, ab, …
+	UpperAlpha = 'A' // A, B, C, …
+	LowerRoman = 'i' // i, ii, iii, …
+	UpperRoman = 'I' // I, II, III, …
+)
+
+// numberStyles are all the numbering styles.
+const numberStyles = "1aAiI"
+
+// romanNumerals are the values and symbols used to write Roman numerals.
+var romanNumerals = []struct {
+	value  int
+	symbol string
+}{
+	{1000, "m"}, {900, "cm"}, {500, "d"}, {400, "cd"}, {100, "c"}, {90, "xc"},
+	{50, "l"}, {40, "xl"}, {10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"},
+}
+
+// formatNumber returns the number in a numbering style. Letters and Roman numerals are only used for positive
+// numbers.
+func formatNumber(n int, style rune) string {
+	if n <= 0 {
+		return strconv.Itoa(n)
+	}
+	switch style {
+	case LowerAlpha, UpperAlpha:
+		var s []byte
+		for ; n > 0; n = (n - 1) / 26 {
+			s = append([]byte{byte('a' + (n-1)%26)}, s...)
+		}
+		if style == UpperAlpha {
+			return strings.ToUpper(string(s))
+		}
+		return string(s)
+	case LowerRoman, UpperRoman:
+		var b strings.Builder
+		for _, r := range romanNumerals {
+			for ; n >= r.value; n -= r.value {
+				b.WriteString(r.symbol)
+			}
+		}
+		if style == UpperRoman {
+			return strings.ToUpper(b.String())
+		}
+		return b.String()
+	}
+	return strconv.Itoa(n)
+}
+
+// number returns the marker of an ordered list item with the number n at a nesting level of ordered lists, starting
+// at 1. The styles are used in turn for each level.
+func (r Renderer) number(n, level int) string {
+	style := rune(Decimal)
+	if styles := []rune(r.opts.NumberStyles); len(styles) > 0 {
+		style = styles[(level-1)%len(styles)]
+	}
+	return strings.Replace(r.opts.Numbering, "%d", formatNumber(n, style), 1)
+}
+
+// orderedLevel returns the number of ordered lists the node is in, including the node itself.
+func orderedLevel(node ast.Node) int {
+	level := 0
+	for ; node != nil; node = node.GetParent() {
+		if list, ok := node.(*ast.List); ok && list.ListFlags&ast.ListTypeOrdered != 0 {
+			level++
+		}
+	}
+	return level
+}
+
+// task returns the checkbox for a task list item and remembers its text so that the task marker is skipped when the
+// text is written. If the list item is not a task, the checkbox is empty.
+func (r Renderer) task(item *ast.ListItem) string {
+	paragraph, ok := ast.GetFirstChild(item).(*ast.Paragraph)
+	if !ok {
+		return ""
+	}
+	text, ok := ast.GetFirstChild(paragraph).(*ast.Text)
+	if !ok || len(text.Literal) < 4 || text.Literal[0] != '[' || text.Literal[2] != ']' || text.Literal[3] != ' ' {
+		return ""
+	}
+	var checkbox string
+	switch text.Literal[1] {
+	case ' ':
+		checkbox = r.opts.Unchecked
+	case 'x', 'X':
+		checkbox = r.opts.Checked
+	default:
+		return ""
+	}
+	r.buf.task = text
+	return checkbox
+}
+
+// validNumberStyles returns an error unless every character is one of the numbering styles.
+func validNumberStyles(styles string) error {
+	for _, r := range styles {
+		if !strings.ContainsRune(numberStyles, r) {
+			return fmt.Errorf("unknown numbering style %c, use %s", r, numberStyles)
+		}
+	}
+	return nil
+}
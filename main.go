@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"git.mills.io/prologic/go-gopher"
 	"github.com/gomarkdown/markdown"
@@ -9,29 +10,82 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// cache holds the rendered pages. It is resized in main; the zero budget used in tests caches nothing.
+var cache = NewCache(0)
+
 func main() {
-	gopher.HandleFunc("/", serve)
-	port := os.Getenv("GOPHER_PORT")
-	if port == "" {
-		port = "70"
-	}
-	hostname := os.Getenv("GOPHER_HOST")
-	if hostname == "" {
-		hostname = "localhost"
-	}
-	addr := fmt.Sprintf("%s:%s", hostname, port)
-	fmt.Printf("Listening on %s\n", addr)
-	log.Fatal(gopher.ListenAndServe(addr, nil))
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = openLog(config.Log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache.Resize(config.CacheSize)
+	if config.Metrics != "" {
+		go func() {
+			log.Fatal(serveMetrics(config.Metrics))
+		}()
+	}
+	var listeners []net.Listener
+	done := make(chan error, 1)
+	for _, site := range config.Sites {
+		if err := cache.watch(site.Root); err != nil {
+			log.Println(err)
+		}
+		for _, addr := range site.Listen {
+			fmt.Printf("Listening on %s for %s\n", addr, site.Name)
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			listeners = append(listeners, ln)
+			server := &gopher.Server{Addr: addr, Handler: site, Hostname: site.Host}
+			go func() {
+				done <- server.Serve(trackingListener{ln})
+			}()
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	for {
+		select {
+		case err := <-done:
+			log.Fatal(err)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				config = reload(config)
+				continue
+			}
+			// stop accepting new connections and give the active ones some time to finish
+			log.Printf("Received %s, shutting down\n", sig)
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			if !drain(shutdownTimeout) {
+				log.Println("Timeout, closed the remaining connections")
+			}
+			return
+		}
+	}
 }
 
-func serve(w gopher.ResponseWriter, r *gopher.Request) {
+// ServeGopher implements gopher.Handler. The selector is relative to the document root of the site and cannot refer
+// to files outside of it. Clients can ask for a different width, see Site.request.
+func (site *Site) ServeGopher(w gopher.ResponseWriter, r *gopher.Request) {
 	const (
 		unknown = iota
 		file
@@ -39,9 +93,23 @@ func serve(w gopher.ResponseWriter, r *gopher.Request) {
 		dir
 	)
 	t := unknown
-	path := r.Selector
-	fp := filepath.Join(".", filepath.FromSlash(path))
-	fmt.Println("Path: " + fp)
+	outcome := "ok"
+	cw := &countingWriter{ResponseWriter: w}
+	selector, opts, plus := site.request(r.Selector)
+	host, strict := site.settings()
+	if host != "" {
+		r.LocalHost = host
+	}
+	// a page selector ending in a slash asks for the table of contents
+	sections := strings.HasSuffix(selector, "/")
+	selector, opts.Section, _ = strings.Cut(selector, "#")
+	selector = strings.TrimPrefix(path.Clean("/"+selector), "/")
+	fp := filepath.Join(site.Root, filepath.FromSlash(selector))
+	itemType := gopher.ERROR
+	defer func() {
+		metrics.request(itemType, outcome, cw.n)
+	}()
+	log.Println("Path: " + fp)
 	fi, err := os.Stat(fp + ".md")
 	if err == nil {
 		if fi.IsDir() {
@@ -59,82 +127,220 @@ func serve(w gopher.ResponseWriter, r *gopher.Request) {
 			}
 		}
 	}
-	// if nothing was found, abort
+	// "page/section" is a section of a page unless there is a file with that name
+	if t == unknown && opts.Section == "" && path.Dir(selector) != "." {
+		parent := path.Dir(selector)
+		fi, err = os.Stat(filepath.Join(site.Root, filepath.FromSlash(parent)) + ".md")
+		if err == nil && !fi.IsDir() {
+			t = page
+			opts.Section = path.Base(selector)
+			selector = parent
+			fp = filepath.Join(site.Root, filepath.FromSlash(selector))
+		}
+	}
+	// symlinks must not lead outside the document root
+	if t == page && !site.contains(fp+".md") || t != page && t != unknown && !site.contains(fp) {
+		t = unknown
+	}
+	// only pages have sections
+	if opts.Section != "" && (t != page || !hasSection(fp, opts.Section)) {
+		t = unknown
+	}
+	switch t {
+	case file:
+		itemType = typeOf(fp)
+	case page:
+		itemType = gopher.FILE
+		if sections {
+			itemType = gopher.DIRECTORY
+		}
+	case dir:
+		itemType = gopher.DIRECTORY
+	}
+	// menus always end with a period on a line by itself; text files only if the site is strict
+	terminated := itemType == gopher.DIRECTORY || strict && itemType == gopher.FILE
+	// Gopher+ responses start with the length of the data or an error: -1 means the data ends with a period on a
+	// line by itself, -2 means the data ends when the connection is closed
+	if plus {
+		if t == unknown {
+			fmt.Fprint(cw, "-")
+		} else {
+			fmt.Fprint(cw, "+")
+		}
+		if terminated {
+			fmt.Fprint(cw, "-1\r\n")
+		} else {
+			fmt.Fprint(cw, "-2\r\n")
+		}
+	}
+	// if nothing was found, abort; Gopher+ errors start with an error code, 1 meaning that the item is not available
 	if t == unknown {
-		fmt.Fprint(w, "no info available\r\n")
+		outcome = "not_found"
+		if plus {
+			fmt.Fprint(cw, "1 Item is not available.\r\n")
+		} else {
+			fmt.Fprint(cw, "no info available\r\n")
+		}
 		return
 	}
 	// directories are redirected to the index page
 	if t == dir {
-		menu(w, r, fp)
+		start := time.Now()
+		menu(cw, r, fp, selector, opts)
+		fmt.Fprint(cw, ".\r\n")
+		metrics.menuTime(time.Since(start))
+		return
+	}
+	if t == page && sections {
+		start := time.Now()
+		err = contents(cw, r, fp, selector, opts)
+		if err != nil {
+			outcome = "error"
+			log.Println(err)
+		}
+		fmt.Fprint(cw, ".\r\n")
+		metrics.menuTime(time.Since(start))
 		return
 	}
+	var out io.Writer = cw
+	if terminated {
+		tw := newTextWriter(cw)
+		defer tw.Close()
+		out = tw
+	}
 	// if the file exists, serve it
 	if t == file {
 		file, err := os.Open(fp)
 		if err != nil {
-			fmt.Fprint(w, "unable to open file\r\n")
+			outcome = "error"
+			fmt.Fprint(out, "unable to open file\r\n")
 			log.Println(err)
 			return
 		}
+		defer file.Close()
 		// copy file
-		_, err = io.Copy(w, file)
+		_, err = io.Copy(out, file)
 		if err != nil {
-			fmt.Fprint(w, "unable to copy file\r\n")
+			outcome = "error"
+			fmt.Fprint(out, "unable to copy file\r\n")
 			log.Println(err)
 			return
 		}
 		return
 	}
-	md, err := load(fp)
+	start := time.Now()
+	opts.Base = path.Dir(selector)
+	err = load(out, fp, opts)
+	metrics.renderTime(time.Since(start))
 	if err != nil {
-		fmt.Fprint(w, "unable to load file\r\n")
+		outcome = "error"
 		log.Println(err)
-		return
 	}
-	w.Write(md)
 }
 
-func menu(w gopher.ResponseWriter, r *gopher.Request, path string) {
-	fi, err := os.ReadFile(filepath.Join(path, "index.md"))
+// menu writes a menu for the directory fp. The selectors of the items are relative to the selector of the directory.
+// The text of the items uses the charset of the options.
+func menu(w gopher.ResponseWriter, r *gopher.Request, fp, selector string, opts Options) {
+	fi, err := readMarkdown(filepath.Join(fp, "index.md"))
 	if err != nil {
-		filepath.Walk(path, func(p string, info fs.FileInfo, err error) error {
+		filepath.WalkDir(fp, func(p string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if p == path {
+			if p == fp {
 				return nil
-			} else if info.IsDir() {
+			} else if d.IsDir() {
 				return filepath.SkipDir
-			} else if strings.HasSuffix(path, ".md") {
-				name := path[:len(path)-3]
-				fmt.Fprintf(w, "0%s\t%s\t%s\t%d\r\n", name, name, r.LocalHost, r.LocalPort)
+			} else if strings.HasSuffix(p, ".md") {
+				name := strings.TrimSuffix(d.Name(), ".md")
+				fmt.Fprintf(w, "0%s\t%s\t%s\t%d\r\n", menuText(name, opts), path.Join(selector, name), r.LocalHost, r.LocalPort)
 			}
 			return nil
 		})
 	} else {
-		re := regexp.MustCompile(`(?m)^\* \[(.*?)\]\((.*?)\)`)
+		re := regexp.MustCompile(`(?m)^\* (!?)\[(.*?)\]\((.*?)\)`)
 		for _, m := range re.FindAllSubmatch(fi, -1) {
-			fmt.Fprintf(w, "0%s\t%s\t%s\t%d\r\n", string(m[1]), filepath.Join(path, string(m[2])), r.LocalHost, r.LocalPort)
+			if len(m[1]) == 0 {
+				fmt.Fprintf(w, "0%s\t%s\t%s\t%d\r\n", menuText(string(m[2]), opts), path.Join(selector, string(m[3])), r.LocalHost,
+					r.LocalPort)
+				continue
+			}
+			// images link to the image file or, if remote, to the URL; the title is used if there is no alt text
+			link, title, _ := strings.Cut(string(m[3]), " ")
+			text := string(m[2])
+			if text == "" {
+				text = strings.Trim(strings.TrimSpace(title), `"'`)
+			}
+			text = menuText(text, opts)
+			if strings.Contains(link, "://") {
+				fmt.Fprintf(w, "h%s\tURL:%s\t%s\t%d\r\n", text, link, r.LocalHost, r.LocalPort)
+			} else {
+				fmt.Fprintf(w, "%c%s\t%s\t%s\t%d\r\n", typeOf(filepath.Join(fp, filepath.FromSlash(link))), text,
+					path.Join(selector, link), r.LocalHost, r.LocalPort)
+			}
 		}
 	}
 }
 
-func load(path string) ([]byte, error) {
-	md, err := os.ReadFile(path + ".md")
+// load writes the page for a path without the ".md" extension to the writer, rendered using the options. Cached pages
+// are written as they are. Otherwise, the page is written while it is being rendered and a copy is kept for the cache
+// unless the page is too big for a cache entry, in which case no copy is kept.
+func load(w io.Writer, path string, opts Options) error {
+	fp := path + ".md"
+	fi, err := os.Stat(fp)
 	if err != nil {
-		return nil, err
+		fmt.Fprint(w, "unable to load file\r\n")
+		return err
+	}
+	key := cacheKey{path: fp, variant: fmt.Sprint(opts), mtime: fi.ModTime(), size: fi.Size()}
+	if content, ok := cache.Get(key); ok {
+		_, err = w.Write(content)
+		return err
+	}
+	md, err := readMarkdown(fp)
+	if err != nil {
+		fmt.Fprint(w, "unable to load file\r\n")
+		return err
+	}
+	doc := markdown.Parse(md, wikiParser())
+	buf := &limitedBuffer{max: cache.MaxEntry()}
+	err = NewRenderer(opts).Render(newEncoder(io.MultiWriter(w, buf), opts.Charset), doc)
+	if err != nil {
+		return err
+	}
+	if !buf.overflow {
+		cache.Put(key, buf.Bytes())
+	}
+	return nil
+}
+
+// limitedBuffer is a buffer that stops collecting bytes once it would exceed its limit. Writes never fail.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+// Write implements io.Writer.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if !b.overflow {
+		if b.Len()+len(p) > b.max {
+			b.overflow = true
+			b.Buffer = bytes.Buffer{}
+		} else {
+			b.Buffer.Write(p)
+		}
 	}
-	ast := markdown.Parse(md, wikiParser())
-	content := markdown.Render(ast, NewRenderer())
-	return content, nil
+	return len(p), nil
 }
 
 // wikiParser returns a parser with the Oddmu specific changes.
 // Specifically: [[wiki links]], #hash_tags, @webfinger@accounts.
-// It also uses the CommonExtensions without MathJax ($).
+// It also uses the CommonExtensions without MathJax ($) but with AutoHeadingIDs, Footnotes, OrderedListStart and
+// Attributes.
 func wikiParser() *parser.Parser {
-	extensions := parser.CommonExtensions & ^parser.MathJax
+	extensions := parser.CommonExtensions&^parser.MathJax | parser.AutoHeadingIDs | parser.Footnotes |
+		parser.OrderedListStart | parser.Attributes
 	parser := parser.NewWithExtensions(extensions)
 	prev := parser.RegisterInline('[', nil)
 	parser.RegisterInline('[', wikiLink(prev))
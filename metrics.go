@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"git.mills.io/prologic/go-gopher"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histograms, in seconds.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// histogram counts observations in cumulative buckets, the way Prometheus expects them.
+type histogram struct {
+	counts []uint64 // one per bucket in latencyBuckets
+	sum    float64
+	count  uint64
+}
+
+// requestLabels are the labels of the request counter.
+type requestLabels struct {
+	itemType string
+	outcome  string
+}
+
+// Metrics collects the numbers exposed to Prometheus. It is safe for concurrent use.
+type Metrics struct {
+	mu          sync.Mutex
+	requests    map[requestLabels]uint64
+	render      histogram
+	menu        histogram
+	bytes       uint64
+	connections int64
+}
+
+// metrics are the metrics of this process.
+var metrics = NewMetrics()
+
+// NewMetrics returns new metrics with all counters at zero.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[requestLabels]uint64),
+		render:   histogram{counts: make([]uint64, len(latencyBuckets))},
+		menu:     histogram{counts: make([]uint64, len(latencyBuckets))},
+	}
+}
+
+// observe adds a duration to a histogram.
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, le := range latencyBuckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+// request counts a request for an item type with its outcome and the bytes written.
+func (m *Metrics) request(itemType gopher.ItemType, outcome string, n uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestLabels{string(itemType), outcome}]++
+	m.bytes += n
+}
+
+// renderTime records how long it took to render a page.
+func (m *Metrics) renderTime(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.render.observe(d)
+}
+
+// menuTime records how long it took to generate a menu.
+func (m *Metrics) menuTime(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.menu.observe(d)
+}
+
+// open changes the number of open connections.
+func (m *Metrics) open(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connections += n
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.mu.Lock()
+	b.WriteString("# HELP gopher_requests_total Gopher requests by item type and outcome.\n")
+	b.WriteString("# TYPE gopher_requests_total counter\n")
+	labels := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].itemType != labels[j].itemType {
+			return labels[i].itemType < labels[j].itemType
+		}
+		return labels[i].outcome < labels[j].outcome
+	})
+	for _, l := range labels {
+		fmt.Fprintf(&b, "gopher_requests_total{type=%q,outcome=%q} %d\n", l.itemType, l.outcome, m.requests[l])
+	}
+	writeHistogram(&b, "gopher_render_seconds", "Time spent rendering pages.", &m.render)
+	writeHistogram(&b, "gopher_menu_seconds", "Time spent generating menus.", &m.menu)
+	b.WriteString("# HELP gopher_bytes_served_total Bytes written to clients.\n")
+	b.WriteString("# TYPE gopher_bytes_served_total counter\n")
+	fmt.Fprintf(&b, "gopher_bytes_served_total %d\n", m.bytes)
+	b.WriteString("# HELP gopher_open_connections Connections currently open.\n")
+	b.WriteString("# TYPE gopher_open_connections gauge\n")
+	fmt.Fprintf(&b, "gopher_open_connections %d\n", m.connections)
+	m.mu.Unlock()
+	stats := cache.Stats()
+	b.WriteString("# HELP gopher_cache_hits_total Rendered pages served from the cache.\n")
+	b.WriteString("# TYPE gopher_cache_hits_total counter\n")
+	fmt.Fprintf(&b, "gopher_cache_hits_total %d\n", stats.Hits)
+	b.WriteString("# HELP gopher_cache_misses_total Rendered pages not found in the cache.\n")
+	b.WriteString("# TYPE gopher_cache_misses_total counter\n")
+	fmt.Fprintf(&b, "gopher_cache_misses_total %d\n", stats.Misses)
+	b.WriteString("# HELP gopher_cache_entries Rendered pages in the cache.\n")
+	b.WriteString("# TYPE gopher_cache_entries gauge\n")
+	fmt.Fprintf(&b, "gopher_cache_entries %d\n", stats.Entries)
+	b.WriteString("# HELP gopher_cache_bytes Bytes used by the cache.\n")
+	b.WriteString("# TYPE gopher_cache_bytes gauge\n")
+	fmt.Fprintf(&b, "gopher_cache_bytes %d\n", stats.Bytes)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeHistogram writes a histogram in the Prometheus text format.
+func writeHistogram(b *strings.Builder, name, help string, h *histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(b, "%s_bucket{le=\"%g\"} %d\n", name, le, h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// serveMetrics serves the metrics via HTTP on a loopback address such as "localhost:9070". Other addresses are
+// refused because the metrics are not meant for the public.
+func serveMetrics(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("metrics must use a loopback address, not %s", addr)
+	}
+	log.Printf("Metrics on http://%s/metrics\n", addr)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	return http.ListenAndServe(addr, mux)
+}
+
+// countingWriter is a response writer that counts the bytes written.
+type countingWriter struct {
+	gopher.ResponseWriter
+	n uint64
+}
+
+// Write implements io.Writer.
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += uint64(n)
+	return n, err
+}
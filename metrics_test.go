@@ -0,0 +1,32 @@
+package main
+
+import (
+	"git.mills.io/prologic/go-gopher"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.request(gopher.FILE, "ok", 100)
+	m.request(gopher.FILE, "ok", 20)
+	m.request(gopher.DIRECTORY, "not_found", 5)
+	m.renderTime(2 * time.Millisecond)
+	var b strings.Builder
+	m.WriteTo(&b)
+	s := b.String()
+	assert.Contains(t, s, `gopher_requests_total{type="0",outcome="ok"} 2`+"\n")
+	assert.Contains(t, s, `gopher_requests_total{type="1",outcome="not_found"} 1`+"\n")
+	assert.Contains(t, s, "gopher_bytes_served_total 125\n")
+	assert.Contains(t, s, `gopher_render_seconds_bucket{le="0.001"} 0`+"\n")
+	assert.Contains(t, s, `gopher_render_seconds_bucket{le="0.005"} 1`+"\n")
+	assert.Contains(t, s, `gopher_render_seconds_bucket{le="+Inf"} 1`+"\n")
+	assert.Contains(t, s, "gopher_menu_seconds_count 0\n")
+}
+
+func TestMetricsLoopback(t *testing.T) {
+	assert.Error(t, serveMetrics("0.0.0.0:9070"))
+	assert.Error(t, serveMetrics("example.org:9070"))
+}
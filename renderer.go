@@ -12,28 +12,95 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
-	"jaytaylor.com/html2text"
-	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/html"
 	"io"
+	"path"
 	"strings"
-	"unicode"
 	"unicode/utf8"
 )
 
 var (
-	newline        = "\n"
-	space          = " "
-	rule           = "----------------------------------------------------------------------"
-	bullet         = "*"
-	majorUnderline = "="
-	minorUnderline = "-"
+	space = " "
 )
 
+// Options are the settings of a Renderer. Use DefaultOptions and change what needs changing.
+type Options struct {
+	Width            int       // max number of columns to fill for each line
+	Newline          string    // the line ending
+	Bullet           string    // the bullet for unordered list items
+	Numbering        string    // the format for the number of ordered list items, e.g. "%d." or "%d)"
+	Rule             string    // the string repeated for a horizontal rule
+	RuleLength       int       // how often Rule is repeated
+	MajorUnderline   string    // the string repeated to underline level 1 headings
+	MinorUnderline   string    // the string repeated to underline all other headings
+	Indent           int       // the minimum number of spaces to indent per nesting level of lists
+	Headings         [6]string // the style for each heading level, one of HeadingStyles
+	NumberStyles     string    // the numbering style for each nesting level of ordered lists, e.g. "1ai"
+	Unchecked        string    // the checkbox for open task list items
+	Checked          string    // the checkbox for done task list items
+	NumberHeadings   bool      // number the headings: 1, 1.1, 1.1.1, and so on
+	TOC              int       // the number of headings required to insert a table of contents; zero for never
+	TOCTitle         string    // the heading of the table of contents
+	Term             string    // the format for terms of definition lists, e.g. "%s" or "*%s*"
+	DefinitionIndent int       // the number of spaces to indent definitions
+	TableStyle       string    // the style of table borders, one of TableStyles
+	Section          string    // the heading ID of the only section to render; empty for all of the document
+	Base             string    // the selector of the directory of the page, for the selectors of images
+	FootnoteMarker   string    // the format for footnote references and footnotes, e.g. "[%d]" or "[^%d]"
+	NotesTitle       string    // the heading of the footnotes at the end of the document
+	CodeIndent       int       // the number of spaces to indent code blocks
+	CodeFence        string    // the line before and after code blocks, followed by the language; empty for none
+	LongCode         string    // what to do with code lines longer than the width, one of LongCodePolicies
+	CodeTruncated    string    // the marker at the end of truncated code lines
+	CodeContinued    string    // the marker at the end of wrapped code lines
+	Emphasis         string    // the marker around emphasis, e.g. "_" or "/"; empty for none
+	Strong           string    // the marker around strong emphasis, e.g. "*", or Uppercase; empty for none
+	Deleted          string    // the marker around deleted text, e.g. "~", or Strike; empty for none
+	InlineCode       string    // the marker around inline code, e.g. "`" or "‘ ’"; empty for none
+	VerseIndent      int       // the number of spaces to indent over-long lines of verse
+	LongWords        string    // what to do with words longer than a line, one of LongWordPolicies
+	Justify          bool      // fill every line of a paragraph except the last one by adding spaces between words
+	Charset          string    // the charset of the output, one of Charsets
+}
+
+// DefaultOptions returns the default options: 72 runes per line and Unix line endings.
+func DefaultOptions() Options {
+	return Options{
+		Width:            72,
+		Newline:          "\n",
+		Bullet:           "*",
+		Numbering:        "%d.",
+		Rule:             "-",
+		RuleLength:       70,
+		MajorUnderline:   "=",
+		MinorUnderline:   "-",
+		Indent:           2,
+		NumberStyles:     "1",
+		Unchecked:        "[ ]",
+		Checked:          "[x]",
+		Headings:         [6]string{Setext, Setext, Setext, Setext, Setext, Setext},
+		TOCTitle:         "Contents",
+		Term:             "%s",
+		DefinitionIndent: 4,
+		TableStyle:       ASCII,
+		FootnoteMarker:   "[%d]",
+		NotesTitle:       "Notes",
+		CodeIndent:       4,
+		LongCode:         Keep,
+		CodeTruncated:    "…",
+		CodeContinued:    "\\",
+		Deleted:          "~",
+		VerseIndent:      4,
+		LongWords:        Keep,
+		Charset:          UTF8,
+	}
+}
+
 // Counter is a counter for list items.
 type Counter struct {
 	counter []int
+	widths  []int // the width of the widest marker of each list
 }
 
 // Wrapper is a wordwrapper based on the ideas in https://godoc.org/github.com/karrick/golinewrap.
@@ -41,31 +108,56 @@ type Wrapper struct {
 	Counter
 	first        bool // is this the first block of the document
 	line         *bytes.Buffer
-	max          int // max number of runes to fill for each line
-	remaining    int // remaining runes in the line buffer
-	prefixLength int // how long the prefix is
-	prefix       string // the prefix for lines
-	prefixNext   string // the next prefix (for list items)
-	prefixSkip   bool // skip prefix when prefix changes
-	tab          *tablewriter.Table
-	header       bool // is this a header row for the table
-	footer       bool // is this a footer row for the table
-	row          []string
+	max          int // max number of columns to fill for each line
+	eol          string // the line ending
+	remaining    int // remaining columns in the line buffer
+	start        int // the length of the line buffer once the prefix has been written
+	noSeparator  bool // skip the next paragraph separator
+	tight        int // the number of tight lists the current node is in
+	frames       []frame // the parts of the prefix for lines, from the outside in
+	table        *table // the table being rendered
+	headings     []*ast.Heading // the headings for the table of contents
+	numbers      map[*ast.Heading]string // the section numbers of the headings
+	tocDone      bool // the table of contents was written or must not be written
+	section      map[ast.Node]bool // the top level nodes to render; nil for all of them
+	word         int // the position in the line buffer where the last word starts
+	upper        int // the number of uppercase strong emphasis nodes the current node is in
+	strike       int // the number of struck through nodes the current node is in
+	verse        bool // the current paragraph is verse
+	abbr         []string // the expansions of the abbreviations the current node is in
+	justify      bool // the current paragraph is justified
+	soft         int // the position in the line buffer after the last soft hyphen
+	longWords    string // what to do with words longer than a line, one of LongWordPolicies
+	task         *ast.Text // the text starting with the task marker of the current list item
+}
+
+// frame is a part of the prefix for lines, such as the marker of a quote or the bullet of a list item. The first line
+// written uses the first string; all the following lines use the rest. A list item nested in another list item is
+// indented relative to the outer list item using the indent instead of the rest.
+type frame struct {
+	first  string
+	rest   string
+	indent string
+	list   bool // is this the frame of a list item
+	used   bool // has the first line been written
 }
 
 // Renderer implements markdown. The initial idea of how it was going to work are on https://github.com/tdemin/gmnhg.
 type Renderer struct {
 	buf         *Wrapper
+	opts        Options
 }
 
-// push adds a new counter starting with 0
-func (c *Counter) push() {
-	c.counter = append(c.counter, 0)
+// push adds a new counter such that the first item gets the number first, and the width of its widest marker
+func (c *Counter) push(first, width int) {
+	c.counter = append(c.counter, first-1)
+	c.widths = append(c.widths, width)
 }
 
 // pop removes the last counter
 func (c *Counter) pop() {
 	c.counter = c.counter[:len(c.counter)-1]
+	c.widths = c.widths[:len(c.widths)-1]
 }
 
 // inc increases the current counter by one
@@ -78,6 +170,18 @@ func (c *Counter) value() int {
 	return c.counter[len(c.counter)-1]
 }
 
+// width returns the width of the widest marker of the current list
+func (c *Counter) width() int {
+	return c.widths[len(c.widths)-1]
+}
+
+// writeLine writes a line as it is, with the prefix, and ends it.
+func (buf *Wrapper) writeLine(w io.Writer, line string) {
+	buf.writePrefix()
+	buf.line.WriteString(line)
+	buf.newline(w)
+}
+
 // trim removes the trailing space of the buffer, if any.
 func (buf *Wrapper) trim() {
 	b := buf.line.Bytes()
@@ -86,34 +190,85 @@ func (buf *Wrapper) trim() {
 	}
 }
 
-// setPrefix changes the prefix.
-func (buf *Wrapper) setPrefix(prefix string) {
-	buf.prefix = prefix
-	buf.prefixLength = utf8.RuneCountInString(prefix)
-	if (buf.prefix == "") {
-		buf.prefixNext = ""
+// pushPrefix adds a frame to the prefix. The first line written uses the first string, the following lines use the
+// rest.
+func (buf *Wrapper) pushPrefix(first, rest string) {
+	buf.frames = append(buf.frames, frame{first: first, rest: rest})
+}
+
+// pushListPrefix adds the frame of a list item to the prefix. The following lines are indented by the width of the
+// first string. A nested list item is indented by the same width or by the given minimum, whichever is wider.
+func (buf *Wrapper) pushListPrefix(first string, minimum int) {
+	width := displayWidth(first)
+	rest := strings.Repeat(space, width)
+	indent := strings.Repeat(space, max(width, minimum))
+	buf.frames = append(buf.frames, frame{first: first, rest: rest, indent: indent, list: true})
+}
+
+// popPrefix removes the innermost frame from the prefix.
+func (buf *Wrapper) popPrefix() {
+	buf.frames = buf.frames[:len(buf.frames)-1]
+}
+
+// prefix returns the prefix for the next line. If used is true, only the frames whose first line has been written
+// are considered. These are the outer frames since new frames are always added on the inside.
+func (buf *Wrapper) prefix(used bool) string {
+	var b strings.Builder
+	for i, f := range buf.frames {
+		switch {
+		case !f.used && used:
+			return b.String()
+		case !f.used:
+			b.WriteString(f.first)
+		case f.list && i+1 < len(buf.frames) && buf.frames[i+1].list:
+			b.WriteString(f.indent)
+		default:
+			b.WriteString(f.rest)
+		}
 	}
+	return b.String()
+}
+
+// prefixWidth returns the number of terminal columns the prefix for the next line needs.
+func (buf *Wrapper) prefixWidth() int {
+	return displayWidth(buf.prefix(false))
 }
 
-// writePrefix writes the prefix, but only at the beginning of the line (and if a prefix is set). Call it anytime
-// something is written to the line.
+// writePrefix writes the prefix, but only at the beginning of the line. Call it anytime something is written to the
+// line. Afterwards, the first line of every frame has been written.
 func (buf *Wrapper) writePrefix() {
-	if buf.max == buf.remaining && buf.prefix != "" {
-		buf.line.WriteString(buf.prefix)
-		buf.remaining -= buf.prefixLength
-		if buf.prefixNext != "" {
-			buf.setPrefix(buf.prefixNext)
-			buf.prefixNext = ""
+	if buf.max == buf.remaining {
+		prefix := buf.prefix(false)
+		buf.line.WriteString(prefix)
+		buf.remaining -= displayWidth(prefix)
+		buf.start = buf.line.Len()
+		buf.word = buf.start
+		for i := range buf.frames {
+			buf.frames[i].used = true
 		}
 	}
 }
 
 // write writes a string to the buffer. If necessary, a newline is prepended and the previous line is flushed to the
-// writer. No space or a newline is added at the end. Use this for a horizontal rule or to underline headings.
+// writer. No space or a newline is added at the end. Use this for a horizontal rule or to underline headings. The
+// length of the line is measured in terminal columns.
 func (buf *Wrapper) write(w io.Writer, s string) {
-	required := utf8.RuneCountInString(s) + 1
-	if buf.remaining < required {
-		buf.newline(w)
+	// a string that doesn't follow a space continues the last word
+	if b := buf.line.Bytes(); len(b) <= buf.start || b[len(b)-1] == ' ' {
+		buf.breakable()
+	}
+	required := displayWidth(s) + 1
+	if buf.remaining < required && buf.line.Len() > buf.start {
+		// move the beginning of the word to the next line, too, unless it fills the line on its own
+		word := ""
+		if buf.word > buf.start {
+			word = string(buf.line.Bytes()[buf.word:])
+			buf.line.Truncate(buf.word)
+		}
+		buf.breakLine(w)
+		buf.writePrefix()
+		buf.line.WriteString(word)
+		buf.remaining -= displayWidth(word)
 	}
 	buf.writePrefix()
 	buf.line.WriteString(s)
@@ -125,43 +280,175 @@ func (buf *Wrapper) write(w io.Writer, s string) {
 // function, which might call newline, which flushes the line. At that point, a trailing space is going to be trimmed
 // from the line.
 func (buf *Wrapper) writeWords(w io.Writer, text string) {
-	// if the text starts with whitespace, prepend a single space
+	// if the text starts with whitespace, prepend a single space unless this is the beginning of a line or the line
+	// already ends with a space
 	rune, size := utf8.DecodeRuneInString(text)
-	if size > 0 && unicode.IsSpace(rune) {
-		buf.write(w, space)
+	if size > 0 && isSpace(rune) && buf.remaining != buf.max && !bytes.HasSuffix(buf.line.Bytes(), []byte(space)) {
+		if buf.remaining < 2 {
+			// the space doesn't fit and mustn't start the next line
+			buf.breakLine(w)
+		} else {
+			buf.breakable()
+			buf.write(w, space)
+		}
 	}
-	// always add a single space after every word
-	for _, word := range strings.Fields(text) {
-		buf.write(w, word+space)
+	// always add a single space after every word; lines may also be broken within words, see units
+	for _, word := range fields(text) {
+		parts := units(word)
+		for i, part := range parts {
+			if i > 0 {
+				buf.breakable()
+			}
+			if i == len(parts)-1 {
+				part += space
+			}
+			buf.writePart(w, part)
+		}
 	}
 	// if the text doesn't end with whitespace, trim that last space again
 	rune, size = utf8.DecodeLastRuneInString(text)
-	if size == 0 || !unicode.IsSpace(rune) {
+	if size == 0 || !isSpace(rune) {
 		buf.trim()
 	}
 }
 
-// newline trims a trailing space from the line, appends a newline and flushes the line to the underlying writer. Every
+// writePart writes a part of a word as returned by units. Parts too long for a line are broken if the policy for long
+// words says so.
+func (buf *Wrapper) writePart(w io.Writer, part string) {
+	soft := strings.HasSuffix(part, softHyphen)
+	part = strings.ReplaceAll(part, softHyphen, "")
+	for buf.longWords == Wrap {
+		available := buf.max - buf.prefixWidth() - 1
+		if displayWidth(strings.TrimSuffix(part, space)) <= available {
+			break
+		}
+		head, tail := cut(part, available)
+		if head == "" {
+			break
+		}
+		buf.write(w, head)
+		buf.breakable()
+		part = tail
+	}
+	buf.write(w, part)
+	if soft {
+		buf.soft = buf.line.Len()
+	}
+}
+
+// breakLine ends a line because the next word doesn't fit. A soft hyphen at the end of the line is shown and the line
+// is justified, if required.
+func (buf *Wrapper) breakLine(w io.Writer) {
+	if buf.soft == buf.line.Len() {
+		buf.line.WriteString("-")
+	}
+	if buf.justify {
+		buf.justifyLine()
+	}
+	buf.newline(w)
+}
+
+// justifyLine adds spaces between the words of the line so that it is as long as the longest lines write produces. The
+// spaces are distributed evenly, the gaps on the left getting the extra spaces.
+func (buf *Wrapper) justifyLine() {
+	line := strings.TrimRight(buf.line.String(), space)
+	words := strings.Split(line[buf.start:], space)
+	gaps := len(words) - 1
+	extra := buf.max - 2 - displayWidth(line)
+	if gaps == 0 || extra <= 0 {
+		return
+	}
+	prefix := line[:buf.start]
+	buf.line.Reset()
+	buf.line.WriteString(prefix)
+	for i, word := range words {
+		buf.line.WriteString(word)
+		if i < gaps {
+			n := 1 + extra/gaps
+			if i < extra%gaps {
+				n++
+			}
+			buf.line.WriteString(strings.Repeat(space, n))
+		}
+	}
+}
+
+// breakable allows the line to be broken before the next string written.
+func (buf *Wrapper) breakable() {
+	buf.word = buf.line.Len()
+}
+
+// newline trims trailing spaces from the line, appends a newline and flushes the line to the underlying writer. Every
 // block element must end with a call to newline or the last line of the document will not be flushed.
 func (buf *Wrapper) newline(w io.Writer) {
-	buf.trim()
-	buf.line.WriteString(newline)
+	buf.line.Truncate(len(bytes.TrimRight(buf.line.Bytes(), space)))
+	buf.line.WriteString(buf.eol)
 	buf.remaining = buf.max
+	buf.start = 0
+	buf.soft = 0
 	buf.line.WriteTo(w)
 }
 
-// NewRenderer returns a new Renderer.
-func NewRenderer() Renderer {
+// WithWidth returns the options for a different line width. The horizontal rule keeps its distance from the right
+// margin.
+func (opts Options) WithWidth(width int) Options {
+	n := displayWidth(opts.Rule)
+	if n > 0 {
+		margin := opts.Width - n*opts.RuleLength
+		opts.RuleLength = max(1, (width-margin)/n)
+	}
+	opts.Width = width
+	return opts
+}
+
+// NewRenderer returns a new Renderer using the options.
+func NewRenderer(opts Options) Renderer {
+	if opts.Charset != UTF8 {
+		opts = opts.transliterate()
+	}
 	wrapper := Wrapper{
 		first:      true,
-		line:       bytes.NewBuffer(make([]byte, 0, 73)),
-		max:        72,
-		remaining:  72,
-		prefix:     "",
-		prefixNext: "",
-		prefixSkip: false,
+		line:       bytes.NewBuffer(make([]byte, 0, opts.Width+1)),
+		max:        opts.Width,
+		eol:        opts.Newline,
+		remaining:  opts.Width,
+		longWords:  opts.LongWords,
 	}
-	return Renderer{buf: &wrapper}
+	return Renderer{buf: &wrapper, opts: opts}
+}
+
+// errWriter is a writer that remembers the first error. Once there was an error, nothing else is written.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+// Write implements io.Writer.
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// Render walks the document and writes each line to the writer as soon as it is done. Unlike markdown.Render, the
+// rendered page is never held in memory. Rendering stops at the first error writing to the writer and that error is
+// returned, e.g. when the client hung up.
+func (r Renderer) Render(w io.Writer, doc ast.Node) error {
+	ew := &errWriter{w: w}
+	r.RenderHeader(ew, doc)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if ew.err != nil {
+			return ast.Terminate
+		}
+		return r.RenderNode(ew, node, entering)
+	})
+	r.RenderFooter(ew, doc)
+	return ew.err
 }
 
 // RenderHeader implements Renderer.RenderHeader(). As there is no header, there is nothing to do, here.
@@ -174,143 +461,279 @@ func (r Renderer) RenderFooter(w io.Writer, node ast.Node) {}
 // there are enough words for a line, it is written to the Writer.
 func (r Renderer) RenderNode(w io.Writer, node ast.Node, entering bool) ast.WalkStatus {
 	// fmt.Printf("%T %v\n", node, entering)
+	if _, ok := node.GetParent().(*ast.Document); ok && r.buf.section != nil && !r.buf.section[node] {
+		return ast.SkipChildren
+	}
 	switch node := node.(type) {
 	case *ast.BlockQuote:
 		if entering {
-			r.buf.setPrefix("> ")
-			r.buf.prefixSkip = true
+			r.buf.pushPrefix("> ", "> ")
 		} else {
-			r.buf.setPrefix("")
+			r.buf.popPrefix()
 		}
 	case *ast.List:
 		if entering {
-			r.buf.push()
+			// tight lists have no empty lines between their items
+			if node.Tight {
+				if r.buf.tight == 0 {
+					r.paragraphSeparator(w)
+				}
+				r.buf.tight++
+			}
+			// numbers are right-aligned
+			first := max(node.Start, 1)
+			width := 0
+			if node.ListFlags&ast.ListTypeOrdered != 0 && !node.IsFootnotesList {
+				width = displayWidth(r.number(first+len(node.Children)-1, orderedLevel(node)))
+			}
+			r.buf.push(first, width)
 		} else {
+			if node.Tight {
+				r.buf.tight--
+			}
 			r.buf.pop()
 		}
 	case *ast.ListItem:
 		if entering {
 			r.buf.inc()
 			isOrdered := (node.ListFlags & ast.ListTypeOrdered) == ast.ListTypeOrdered
-			isDefinition := (node.ListFlags & ast.ListTypeTerm) == ast.ListTypeTerm
+			isTerm := (node.ListFlags & ast.ListTypeTerm) == ast.ListTypeTerm
+			isDefinition := (node.ListFlags & ast.ListTypeDefinition) == ast.ListTypeDefinition
 			isUnordered := !isOrdered && !isDefinition
-			indentation := strings.Repeat(space, 2 * (len(r.buf.counter)-1))
-			if isUnordered {
-				r.buf.setPrefix(indentation + bullet + space)
-				r.buf.prefixNext = strings.Repeat(space, len(r.buf.prefix))
-			} else if isOrdered {
-				r.buf.setPrefix(fmt.Sprintf("%s%d. ", indentation, r.buf.value()))
-				r.buf.prefixNext = strings.Repeat(space, len(r.buf.prefix))
-			} else if r.buf.value() > 1 {
-				// definition lists get extra line breaks
+			if isTerm {
+				// terms are on a line of their own and their first definition follows immediately
+				r.paragraphSeparator(w)
+				r.buf.pushPrefix("", "")
+				term := transliterate(strings.Join(fields(plainText(node)), space), r.opts.Charset)
+				r.buf.writeWords(w, fmt.Sprintf(r.opts.Term, term))
 				r.buf.newline(w)
-				r.buf.setPrefix(indentation)
+				r.buf.noSeparator = true
+				return ast.SkipChildren
+			} else if isDefinition {
+				definition := strings.Repeat(space, r.opts.DefinitionIndent)
+				r.buf.pushPrefix(definition, definition)
+			} else if node.RefLink != nil {
+				// footnotes use the same marker as the references; short footnotes have no paragraph to separate them
+				if _, ok := ast.GetFirstChild(node).(*ast.Paragraph); !ok {
+					r.paragraphSeparator(w)
+				}
+				r.buf.pushListPrefix(fmt.Sprintf(r.opts.FootnoteMarker, r.buf.value())+space, r.opts.Indent)
+			} else if isUnordered {
+				bullet := r.opts.Bullet
+				if checkbox := r.task(node); checkbox != "" {
+					bullet = checkbox
+				}
+				r.buf.pushListPrefix(bullet+space, r.opts.Indent)
+			} else {
+				number := r.number(r.buf.value(), orderedLevel(node))
+				number = strings.Repeat(space, max(0, r.buf.width()-displayWidth(number))) + number
+				r.buf.pushListPrefix(number+space, r.opts.Indent)
 			}
-			r.buf.prefixSkip = true
 		} else {
-			r.buf.setPrefix("")
+			// short footnotes have no paragraph to end the line
+			if node.RefLink != nil && r.buf.remaining != r.buf.max {
+				r.buf.newline(w)
+			}
+			r.buf.popPrefix()
+		}
+	case *ast.Footnotes:
+		if entering {
+			r.paragraphSeparator(w)
+			r.writeHeading(w, r.opts.NotesTitle, r.topLevel())
+		}
+	case *ast.Link:
+		if node.NoteID > 0 {
+			if entering {
+				r.buf.writeWords(w, fmt.Sprintf(r.opts.FootnoteMarker, node.NoteID))
+			}
+			return ast.SkipChildren
 		}
 	case *ast.HorizontalRule:
 		r.paragraphSeparator(w)
-		r.buf.write(w, rule)
+		r.buf.write(w, strings.Repeat(r.opts.Rule, r.opts.RuleLength))
 		r.buf.newline(w)
 	case *ast.Heading:
 		if entering {
 			r.paragraphSeparator(w)
-		} else {
-			// After the text of the heading, add underlining
-			r.buf.newline(w)
-			text := ast.GetFirstChild(node).AsLeaf()
-			var s string
-			if node.Level == 1 {
-				s = majorUnderline
-			} else {
-				s = minorUnderline
+			r.heading(w, node)
+			// the table of contents follows the first heading, if the page is long enough
+			if !r.buf.tocDone && r.opts.TOC > 0 && len(r.buf.headings) >= r.opts.TOC {
+				r.toc(w)
 			}
-			r.buf.write(w, strings.Repeat(s, len(text.Literal)))
-			r.buf.newline(w)
+			r.buf.tocDone = true
+			return ast.SkipChildren
 		}
 	case *ast.Paragraph:
-		if entering {
+		if isTOCMarker(node) {
+			if entering {
+				r.toc(w)
+			}
+			return ast.SkipChildren
+		} else if entering {
 			r.paragraphSeparator(w)
+			r.buf.justify = r.opts.Justify
+			if isVerse(node) {
+				r.buf.justify = false
+				// over-long lines of verse continue with a hanging indent
+				r.buf.verse = true
+				r.buf.pushPrefix("", strings.Repeat(space, r.opts.VerseIndent))
+			}
 		} else {
 			r.buf.newline(w)
+			r.buf.justify = false
+			if r.buf.verse {
+				r.buf.verse = false
+				r.buf.popPrefix()
+			}
 		}
+	case *ast.Hardbreak:
+		r.lineBreak(w)
 	case *ast.CodeBlock:
-		newline := []byte("\n")
-		separator := []byte("\n    ")
-		w.Write(separator)
-		w.Write(bytes.Replace(node.Literal, newline,  separator, bytes.Count(node.Literal, newline)-1))
+		r.paragraphSeparator(w)
+		r.codeBlock(w, node)
 	case *ast.Table:
-		// The tablewriter needs to be fed cells in rows.
+		// The table can only be written once all the cells are known.
 		if entering {
-			r.buf.tab = tablewriter.NewWriter(w)
-			r.buf.newline(w)
+			r.paragraphSeparator(w)
+			r.buf.table = &table{}
 		} else {
-			r.buf.tab.Render()
+			if r.buf.table.streaming {
+				r.records(w, r.buf.table)
+			} else {
+				r.renderTable(w, r.buf.table)
+			}
+			r.buf.table = nil
 		}
 	case *ast.TableRow:
+		if !entering {
+			t := r.buf.table
+			t.endRow()
+			if t.streaming || t.size > maxTableSize {
+				// the table is too big to be kept until the end
+				t.streaming = true
+				r.records(w, t)
+			}
+		}
+	case *ast.TableHeader, *ast.TableBody, *ast.TableFooter:
 		if entering {
-			r.buf.row = make([]string, 0)
-		} else if r.buf.header {
-			r.buf.tab.SetHeader(r.buf.row)
-		} else if r.buf.footer {
-			r.buf.tab.SetFooter(r.buf.row)
-		} else {
-			r.buf.tab.Append(r.buf.row)
+			r.buf.table.part = node
 		}
-	case *ast.TableHeader:
-		r.buf.header = entering
-	case *ast.TableFooter:
-		r.buf.footer = entering
-	case *ast.TableBody:
 	case *ast.TableCell:
 		if entering {
-			// render the children of the table cell (without the table cell itself)
+			// render the children of the table cell (without the table cell itself) as a single line
 			doc := &ast.Document{}
 			doc.SetChildren(node.GetChildren())
-			s := string(markdown.Render(doc, NewRenderer()))
-			r.buf.row = append(r.buf.row, s)
+			cell := &r.buf.table.cell
+			cell.Reset()
+			NewRenderer(r.opts).Render(cell, doc)
+			r.buf.table.addCell(strings.Join(fields(cell.String()), space), node.Align)
 			return ast.SkipChildren
 		}
+	case *ast.Image:
+		if entering {
+			// images get a line of their own
+			if r.buf.remaining != r.buf.max {
+				r.buf.newline(w)
+			}
+			placeholder := transliterate(imagePlaceholder(node), r.opts.Charset)
+			r.buf.writeWords(w, placeholder+space+imageSelector(string(node.Destination), r.opts.Base))
+			if followedByText(node) {
+				r.buf.newline(w)
+			}
+		}
+		return ast.SkipChildren
 	case *ast.Text:
-		r.buf.writeWords(w, string(node.Literal))
+		literal := node.Literal
+		if node == r.buf.task {
+			literal = literal[4:]
+		}
+		text := string(literal)
+		if isEntity(literal) {
+			text = html.UnescapeString(text)
+		}
+		text = transliterate(text, r.opts.Charset)
+		if r.buf.verse {
+			r.writeVerse(w, r.inline(text))
+		} else {
+			r.buf.writeWords(w, r.inline(text))
+		}
 	case *ast.Code:
-		r.buf.writeWords(w, string(node.Literal))
+		open, close := markers(r.opts.InlineCode)
+		r.buf.writeWords(w, open+r.inline(transliterate(string(node.Literal), r.opts.Charset))+close)
 	case *ast.Emph:
+		r.marker(w, r.opts.Emphasis, entering)
 	case *ast.Strong:
+		r.strong(w, entering)
+	case *ast.Del:
+		r.deleted(w, entering)
+	case *ast.HTMLSpan:
+		r.htmlSpan(w, node)
 	case *ast.Document:
-		if !entering {
+		if entering {
+			r.initSections(node)
+			r.buf.tocDone = hasTOCMarker(node)
+			if r.opts.Section != "" {
+				r.buf.section = sectionNodes(node, r.opts.Section)
+				r.buf.tocDone = true
+			}
+		} else {
 			r.buf.line.WriteTo(w) // flush for TableCell
 		}
 	case *ast.HTMLBlock:
-		r.buf.newline(w)
-		text, err := html2text.FromReader(bytes.NewReader(node.Literal), html2text.Options{PrettyTables: true})
-		if err == nil {
-			r.buf.write(w, text)
-		}
+		r.htmlBlock(w, node)
 	default:
 		text := node.AsLeaf()
 		if text != nil {
-			r.buf.writeWords(w, string(text.Literal))
+			r.buf.writeWords(w, transliterate(string(text.Literal), r.opts.Charset))
 		}
 	}
 	return ast.GoToNext
 }
 
-// paragraphSeparator writes a paragraph separator unless this is the first paragraph. Furthermore, when a new type
-// starts (such as a quote), the prefix is skipped once before the newline. The result is that when a quoted paragraph
-// follows a regular paragraph, the line is empty but if a quoted paragraph follows another quoted paragraph, the line
-// is quoted.
+// imagePlaceholder returns the text shown instead of an image: its alt text or, if there is none, its title.
+func imagePlaceholder(image *ast.Image) string {
+	text := strings.Join(fields(plainText(image)), space)
+	if text == "" {
+		text = strings.Join(fields(string(image.Title)), space)
+	}
+	if text == "" {
+		return "[Image]"
+	}
+	return "[Image: " + text + "]"
+}
+
+// imageSelector returns the selector of a local image, relative to the selector of the directory of the page, or the
+// URL of a remote image.
+func imageSelector(link, base string) string {
+	if strings.Contains(link, "://") {
+		return link
+	}
+	if strings.HasPrefix(link, "/") {
+		return strings.TrimPrefix(path.Clean(link), "/")
+	}
+	return path.Join(base, link)
+}
+
+// followedByText reports whether anything but whitespace follows the node in its parent.
+func followedByText(node ast.Node) bool {
+	for next := ast.GetNextNode(node); next != nil; next = ast.GetNextNode(next) {
+		if text, ok := next.(*ast.Text); !ok || strings.TrimSpace(string(text.Literal)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// paragraphSeparator writes a paragraph separator unless this is the first paragraph. The separator only uses the
+// frames of the prefix whose first line has already been written. The result is that when a quoted paragraph follows a
+// regular paragraph, the line is empty but if a quoted paragraph follows another quoted paragraph, the line is quoted.
 func (r Renderer) paragraphSeparator(w io.Writer) {
 	if r.buf.first {
 		r.buf.first = false
-	} else {
-		if r.buf.prefixSkip {
-			r.buf.prefixSkip = false
-		} else {
-			r.buf.writePrefix()
-		}
+	} else if r.buf.noSeparator {
+		r.buf.noSeparator = false
+	} else if r.buf.tight == 0 {
+		r.buf.line.WriteString(r.buf.prefix(true))
 		r.buf.newline(w)
 	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/parser"
 	"github.com/stretchr/testify/assert"
@@ -80,6 +81,114 @@ This is text.
 	assert.Equal(t, expected, render(body))
 }
 
+func TestHeadingEmphasis(t *testing.T) {
+	body := []byte(`## The *real* story
+`)
+	expected := `The real story
+--------------
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestHeadingLong(t *testing.T) {
+	body := []byte("# " + strings.Repeat("A long title ", 7) + "\n")
+	expected := `A long title A long title A long title A long title A long title A
+long title A long title
+==================================================================
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestHeadingStyles(t *testing.T) {
+	body := []byte(`# Title
+
+## Chapter
+
+### Section
+
+#### Subsection
+
+## Another Chapter
+`)
+	expected := `# Title
+
+## 1 Chapter
+
++-------------+
+| 1.1 Section |
++-------------+
+
+1.1.1 SUBSECTION
+
+## 2 Another Chapter
+`
+	opts := DefaultOptions()
+	opts.Headings = [6]string{ATX, ATX, Boxed, Uppercase, Uppercase, Uppercase}
+	opts.NumberHeadings = true
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestHeadingNumbers(t *testing.T) {
+	body := []byte(`# One
+
+# Two
+
+## Two and a half
+`)
+	expected := `1 One
+=====
+
+2 Two
+=====
+
+2.1 Two and a half
+------------------
+`
+	opts := DefaultOptions()
+	opts.NumberHeadings = true
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestHeadingUmlaut(t *testing.T) {
+	body := []byte(`# Überblick
+`)
+	expected := `Überblick
+=========
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestHeadingEntity(t *testing.T) {
+	body := []byte("# Caf&eacute;\n\nText\n")
+	expected := "Café\n====\n\nText\n"
+	assert.Equal(t, expected, render(body))
+}
+
+func TestHeadingWide(t *testing.T) {
+	body := []byte(`## 日本語
+`)
+	expected := `日本語
+------
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestWideText(t *testing.T) {
+	body := []byte(strings.Repeat("これは日本語の文章です。", 4) + "\n")
+	expected := `これは日本語の文章です。これは日本語の文章です。これは日本語の文章で
+す。これは日本語の文章です。
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestWideQuote(t *testing.T) {
+	body := []byte("> " + strings.Repeat("中文的句子。", 7) + "\n")
+	expected := `> 中文的句子。中文的句子。中文的句子。中文的句子。中文的句子。中文的句
+> 子。中文的句子。
+`
+	assert.Equal(t, expected, render(body))
+}
+
 func TestRule(t *testing.T) {
 	body := []byte(`This is text.
 
@@ -162,6 +271,56 @@ This is text.
 	assert.Equal(t, expected, render(body))
 }
 
+func TestCodeContext(t *testing.T) {
+	body := []byte("```\ncode first\n```\n\n* item\n\n        code in list\n\n> quote\n>\n>     quoted\tcode\n")
+	expected := `    code first
+
+* item
+
+      code in list
+
+> quote
+>
+>     quoted  code
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestCodeFence(t *testing.T) {
+	body := []byte("```go\nfmt.Println(\"Hello\")\n```\n")
+	expected := "```go\nfmt.Println(\"Hello\")\n```\n"
+	opts := DefaultOptions()
+	opts.CodeFence = "```"
+	opts.CodeIndent = 0
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestCodeLong(t *testing.T) {
+	body := []byte("    0123456789 0123456789 0123456789\n")
+	opts := DefaultOptions().WithWidth(20)
+	assert.Equal(t, "    0123456789 0123456789 0123456789\n", renderWith(body, opts))
+	opts.LongCode = Truncate
+	assert.Equal(t, "    0123456789 0123…\n", renderWith(body, opts))
+	opts.LongCode = Wrap
+	assert.Equal(t, "    0123456789 0123\\\n    456789 01234567\\\n    89\n", renderWith(body, opts))
+}
+
+func TestCodeLongNarrow(t *testing.T) {
+	body := []byte("    0123456789\n")
+	opts := DefaultOptions().WithWidth(6)
+	opts.LongCode = Wrap
+	assert.Equal(t, "    0\\\n    1\\\n    2\\\n    3\\\n    4\\\n    5\\\n    6\\\n    7\\\n    89\n", renderWith(body, opts))
+	// without room for the code after the indent, the indent is dropped
+	opts = DefaultOptions().WithWidth(5)
+	opts.LongCode = Wrap
+	assert.Equal(t, "0123\\\n4567\\\n89\n", renderWith(body, opts))
+	quote := strings.Repeat("> ", 8)
+	body = []byte(quote + "```\n" + quote + "0123456789\n" + quote + "```\n")
+	opts = DefaultOptions().WithWidth(20)
+	opts.LongCode = Wrap
+	assert.Equal(t, quote+"012\\\n"+quote+"345\\\n"+quote+"6789\n", renderWith(body, opts))
+}
+
 func TestUnorderedList(t *testing.T) {
 	body := []byte(`This is text.
 
@@ -234,6 +393,70 @@ This is text.
 }
 
 
+func TestListInQuote(t *testing.T) {
+	body := []byte(`> A quote with a list:
+>
+> * one
+> * two is a long item that needs to wrap around to the next line at some point
+>
+> And more.
+`)
+	expected := `> A quote with a list:
+>
+> * one
+> * two is a long item that needs to wrap around
+>   to the next line at some point
+>
+> And more.
+`
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(50)))
+}
+
+func TestQuoteInList(t *testing.T) {
+	body := []byte(`* An item with a quote:
+
+    > Quoted text in a list item that is long enough to wrap around to the next line.
+
+* Another item
+`)
+	expected := `* An item with a quote:
+
+  > Quoted text in a list item that is long
+  > enough to wrap around to the next line.
+
+* Another item
+`
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(50)))
+}
+
+func TestNestedList(t *testing.T) {
+	body := []byte(`* An item with a nested list:
+
+    1. nested
+    2. nested long enough to wrap around to the next line because it is long
+
+    Continuation paragraph of the outer item that is long enough to wrap around.
+
+    * Nested again
+
+        > quoted in nested item
+`)
+	expected := `* An item with a nested list:
+
+  1. nested
+  2. nested long enough to wrap around to the
+     next line because it is long
+
+  Continuation paragraph of the outer item that
+  is long enough to wrap around.
+
+  * Nested again
+
+    > quoted in nested item
+`
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(50)))
+}
+
 func TestOrderedList(t *testing.T) {
 	body := []byte(`This is text.
 
@@ -297,14 +520,175 @@ This is text.`)
 
 1. This is an item.
 
-  1. This is a very long item. This is a very long item. This is a
-     very long item. This is a very long item.
+   1. This is a very long item. This is a very long item. This is a
+      very long item. This is a very long item.
 
 This is text.
 `
 	assert.Equal(t, expected, render(body))
 }
 
+func TestDefinitionList(t *testing.T) {
+	body := []byte(`Apple
+:   Pomaceous fruit of plants of the genus Malus in the family Rosaceae, long enough to wrap.
+:   A company.
+
+Orange
+:   Citrus fruit.
+
+    Second paragraph.
+
+Text.
+`)
+	expected := `*Apple*
+    Pomaceous fruit of plants of the
+    genus Malus in the family
+    Rosaceae, long enough to wrap.
+
+    A company.
+
+*Orange*
+    Citrus fruit.
+
+    Second paragraph.
+
+Text.
+`
+	opts := DefaultOptions().WithWidth(40)
+	opts.Term = "*%s*"
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestOrderedListStart(t *testing.T) {
+	body := []byte(`3. three
+4. four
+`)
+	expected := `3. three
+4. four
+`
+	var b strings.Builder
+	NewRenderer(DefaultOptions()).Render(&b, markdown.Parse(body, wikiParser()))
+	assert.Equal(t, expected, b.String())
+}
+
+func TestOrderedListNumbers(t *testing.T) {
+	body := []byte(`8. eight
+9. nine
+10. ten is long enough to wrap around to the next line
+    1. one
+        1. deep
+    2. two
+`)
+	expected := ` 8. eight
+ 9. nine
+10. ten is long enough to wrap around
+    to the next line
+    a. one
+       i. deep
+    b. two
+`
+	opts := DefaultOptions().WithWidth(40)
+	opts.NumberStyles = "1ai"
+	var b strings.Builder
+	NewRenderer(opts).Render(&b, markdown.Parse(body, wikiParser()))
+	assert.Equal(t, expected, b.String())
+}
+
+func TestNestedListAlignment(t *testing.T) {
+	body := []byte(`1. one
+2. two
+3. three
+4. four
+5. five
+6. six
+7. seven
+8. eight
+9. nine
+10. ten
+    1. sub is long enough to wrap around to the next line
+`)
+	expected := ` 1. one
+ 2. two
+ 3. three
+ 4. four
+ 5. five
+ 6. six
+ 7. seven
+ 8. eight
+ 9. nine
+10. ten
+    1. sub is long enough to wrap
+       around to the next line
+`
+	var b strings.Builder
+	NewRenderer(DefaultOptions().WithWidth(40)).Render(&b, markdown.Parse(body, wikiParser()))
+	assert.Equal(t, expected, b.String())
+}
+
+func TestLooseList(t *testing.T) {
+	body := []byte(`* This is an item.
+
+    This is a continuation paragraph.
+
+* This is another item.
+`)
+	expected := `* This is an item.
+
+  This is a continuation paragraph.
+
+* This is another item.
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestTaskList(t *testing.T) {
+	body := []byte(`* [ ] open task with a long text that wraps around the line
+* [x] done
+* normal item
+`)
+	expected := `☐ open task with a long text that
+  wraps around the line
+☑ done
+* normal item
+`
+	opts := DefaultOptions().WithWidth(40)
+	opts.Unchecked = "☐"
+	opts.Checked = "☑"
+	assert.Equal(t, expected, renderWith(body, opts))
+	// the document is unchanged and can be rendered again
+	doc := parser.New().Parse(body)
+	assert.Equal(t, expected, string(markdown.Render(doc, NewRenderer(opts))))
+	assert.Equal(t, expected, string(markdown.Render(doc, NewRenderer(opts))))
+}
+
+func TestInlineMarkers(t *testing.T) {
+	body := []byte("This is *italic*, **bold**, ~~gone~~ and `code`.\n")
+	expected := "This is /italic/, BOLD, g\u0336o\u0336n\u0336e\u0336 and ‘code’.\n"
+	opts := DefaultOptions()
+	opts.Emphasis = "/"
+	opts.Strong = Uppercase
+	opts.Deleted = Strike
+	opts.InlineCode = "‘ ’"
+	assert.Equal(t, expected, renderWith(body, opts))
+	expected = "This is italic, bold, ~gone~ and code.\n"
+	assert.Equal(t, expected, render(body))
+}
+
+func TestInlineMarkersWrap(t *testing.T) {
+	body := []byte("Words and more words, *emphasis at the end*.\n")
+	expected := `Words and more words, _emphasis at
+the end_.
+`
+	opts := DefaultOptions().WithWidth(37)
+	opts.Emphasis = "_"
+	assert.Equal(t, expected, renderWith(body, opts))
+	body = []byte("Words and more words, some more *emphasis*.\n")
+	expected = `Words and more words, some more
+_emphasis_.
+`
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
 func TestTable(t *testing.T) {
 	body := []byte(`This is text.
 
@@ -379,6 +763,85 @@ This is text.
 	assert.Equal(t, expected, render(body))
 }
 
+func TestTableAlign(t *testing.T) {
+	body := []byte(`| Name | Description | Price |
+|:-----|:-----------:|------:|
+| Bob  | A person with a rather long description | 27 |
+| Alice | Short | 2300 |
+`)
+	expected := `+-------+-----------------+-------+
+| NAME  |   DESCRIPTION   | PRICE |
++-------+-----------------+-------+
+| Bob   | A person with a |    27 |
+|       |   rather long   |       |
+|       |   description   |       |
+| Alice |      Short      |  2300 |
++-------+-----------------+-------+
+`
+	opts := DefaultOptions().WithWidth(40)
+	assert.Equal(t, expected, renderWith(body, opts))
+	expected = `┌───────┬─────────────────┬───────┐
+│ NAME  │   DESCRIPTION   │ PRICE │
+├───────┼─────────────────┼───────┤
+│ Bob   │ A person with a │    27 │
+│       │   rather long   │       │
+│       │   description   │       │
+│ Alice │      Short      │  2300 │
+└───────┴─────────────────┴───────┘
+`
+	opts.TableStyle = Unicode
+	assert.Equal(t, expected, renderWith(body, opts))
+	expected = `NAME        DESCRIPTION        PRICE
+-----  ----------------------  -----
+Bob    A person with a rather     27
+          long description
+Alice          Short            2300
+`
+	opts.TableStyle = Minimal
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestTableRecords(t *testing.T) {
+	body := []byte(`> | Name | Description | Price |
+> |------|-------------|-------|
+> | Bob  | A person with a rather long description | 27 |
+> | Alice | Short | 2300 |
+`)
+	expected := `> Name: Bob
+> Description: A
+>   person with a
+>   rather long
+>   description
+> Price: 27
+>
+> Name: Alice
+> Description: Short
+> Price: 2300
+`
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(20)))
+}
+
+func TestTableTooBig(t *testing.T) {
+	defer func(size int) { maxTableSize = size }(maxTableSize)
+	maxTableSize = 12
+	body := []byte(`| Name | Price |
+|------|-------|
+| Bob  | 27    |
+| Alice | 2300 |
+| Carol | 1 |
+`)
+	expected := `Name: Bob
+Price: 27
+
+Name: Alice
+Price: 2300
+
+Name: Carol
+Price: 1
+`
+	assert.Equal(t, expected, render(body))
+}
+
 func TestHtmlBlock(t *testing.T) {
 	body := []byte(`Here are some notifications:
 
@@ -407,13 +870,425 @@ func TestHtmlBlock(t *testing.T) {
 	expected := `Here are some notifications:
 
 Alex 🌈 🦄 🧞 Sound engineer be engineering the sound!
-🎵 1 🛠️ 2 👍 1`
+🎵 1 🛠️ 2 👍 1
+`
 	assert.Equal(t, expected, render(body))
 }
 
+func TestHtmlBlockInQuote(t *testing.T) {
+	body := []byte(`> <div>
+> <p>Block &amp; text that is long and must be wrapped.</p>
+> <p>Second</p>
+> </div>
+
+<!-- a comment -->
+
+End.
+`)
+	expected := `> Block & text that is long
+> and must be wrapped.
+>
+> Second
+
+End.
+`
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(30)))
+}
+
+func TestHtmlSpan(t *testing.T) {
+	body := []byte(`An <abbr title="HyperText Markup Language">HTML</abbr> caf&eacute;<br>
+with <!-- a comment --> a <kbd>Ctrl</kbd>&nbsp;x, <em>emphasis</em> and <b>bold</b>.
+`)
+	expected := `An HTML (HyperText Markup
+Language) café
+with a ` + "`Ctrl`\u00a0x," + `
+_emphasis_ and *bold*.
+`
+	opts := DefaultOptions().WithWidth(30)
+	opts.Emphasis = "_"
+	opts.Strong = "*"
+	opts.InlineCode = "`"
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestOptions(t *testing.T) {
+	body := []byte(`# Heading
+
+This is a very long text. This is a very long text.
+
+## Sub-Heading
+
+* This is a very long item. This is a very long item.
+  1. This is a very long item. This is a very long item.
+
+----
+`)
+	expected := "Heading\r\n" +
+		"#######\r\n" +
+		"\r\n" +
+		"This is a very long text. This is\r\n" +
+		"a very long text.\r\n" +
+		"\r\n" +
+		"Sub-Heading\r\n" +
+		"~~~~~~~~~~~\r\n" +
+		"\r\n" +
+		"- This is a very long item. This\r\n" +
+		"  is a very long item.\r\n" +
+		"    1) This is a very long item.\r\n" +
+		"       This is a very long item.\r\n" +
+		"\r\n" +
+		"<><><><><><><><><><>\r\n"
+	opts := DefaultOptions()
+	opts.Width = 35
+	opts.Newline = "\r\n"
+	opts.Bullet = "-"
+	opts.Numbering = "%d)"
+	opts.Rule = "<>"
+	opts.RuleLength = 10
+	opts.MajorUnderline = "#"
+	opts.MinorUnderline = "~"
+	opts.Indent = 4
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
 func render(input []byte) string {
+	return renderWith(input, DefaultOptions())
+}
+
+func renderWith(input []byte, opts Options) string {
 	p := parser.New()
 	ast := p.Parse(input)
-	content := markdown.Render(ast, NewRenderer())
+	content := markdown.Render(ast, NewRenderer(opts))
 	return string(content)
 }
+
+// failingWriter accepts a number of writes and fails afterwards.
+type failingWriter struct {
+	lines []string
+	max   int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(w.lines) >= w.max {
+		return 0, errors.New("connection closed")
+	}
+	w.lines = append(w.lines, string(p))
+	return len(p), nil
+}
+
+func TestRenderStreaming(t *testing.T) {
+	body := []byte(strings.Repeat("This is text. ", 100))
+	doc := parser.New().Parse(body)
+	w := &failingWriter{max: 2}
+	err := NewRenderer(DefaultOptions()).Render(w, doc)
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"This is text. This is text. This is text. This is text. This is text.\n",
+		"This is text. This is text. This is text. This is text. This is text.\n",
+	}, w.lines)
+}
+
+func TestRenderSame(t *testing.T) {
+	body := []byte("# Title\n\nThis is text.\n\n* An item.\n\nName | Age\n-----|----\nBob  | 27\n")
+	var b strings.Builder
+	assert.NoError(t, NewRenderer(DefaultOptions()).Render(&b, parser.New().Parse(body)))
+	assert.Equal(t, render(body), b.String())
+}
+
+func TestTOC(t *testing.T) {
+	body := []byte(`# Title
+
+## One
+
+## Two
+
+### Two and a half
+`)
+	expected := `Title
+=====
+
+Contents
+--------
+
+* One
+* Two
+  * Two and a half
+
+One
+---
+
+Two
+---
+
+Two and a half
+--------------
+`
+	opts := DefaultOptions()
+	opts.TOC = 3
+	assert.Equal(t, expected, renderWith(body, opts))
+	opts.TOC = 4
+	assert.NotContains(t, renderWith(body, opts), "Contents")
+}
+
+func TestTOCMarker(t *testing.T) {
+	body := []byte(`# One
+
+Text.
+
+[[_TOC_]]
+
+# Two
+`)
+	expected := `1 One
+=====
+
+Text.
+
+Contents
+========
+
+1 One
+2 Two
+
+2 Two
+=====
+`
+	opts := DefaultOptions()
+	opts.NumberHeadings = true
+	opts.TOC = 1
+	assert.Equal(t, expected, renderWith(body, opts))
+	var b strings.Builder
+	NewRenderer(opts).Render(&b, markdown.Parse(body, wikiParser()))
+	assert.Equal(t, expected, b.String())
+}
+
+func TestSection(t *testing.T) {
+	body := []byte(`# One
+
+Text.
+
+## Two
+
+Two text.
+
+### Three
+
+Three text.
+
+## Four
+`)
+	expected := `1 Two
+-----
+
+Two text.
+
+1.1 Three
+---------
+
+Three text.
+`
+	opts := DefaultOptions()
+	opts.NumberHeadings = true
+	opts.Section = "two"
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestFootnotes(t *testing.T) {
+	body := []byte(`This has a note.[^1] And another one.[^long] Inline too.^[Inline note.]
+
+[^1]: The first note is long and it should wrap with a hanging indent
+    so that we can see the result.
+
+[^long]: A note with paragraphs.
+
+    Second paragraph of the note.
+`)
+	expected := `This has a note.[^1] And another one.[^2] Inline too.[^3]
+
+Notes
+=====
+
+[^1] The first note is long and it should wrap with a hanging indent
+     so that we can see the result.
+
+[^2] A note with paragraphs.
+
+     Second paragraph of the note.
+
+[^3] Inline note.
+`
+	opts := DefaultOptions()
+	opts.FootnoteMarker = "[^%d]"
+	var b strings.Builder
+	NewRenderer(opts).Render(&b, markdown.Parse(body, wikiParser()))
+	assert.Equal(t, expected, b.String())
+}
+
+func TestHardbreak(t *testing.T) {
+	body := []byte("> Jane Doe  \n> Main Street 1\\\n> Springfield\nUSA\n")
+	expected := `> Jane Doe
+> Main Street 1
+> Springfield USA
+`
+	assert.Equal(t, expected, render(body))
+}
+
+func TestVerse(t *testing.T) {
+	body := []byte(`{.verse}
+Roses are red, violets are blue, and this line is much too long
+Sugar is sweet
+and so are you.
+
+Prose is
+not verse.
+`)
+	expected := `Roses are red, violets are blue, and
+    this line is much too long
+Sugar is sweet
+and so are you.
+
+Prose is not verse.
+`
+	var b strings.Builder
+	NewRenderer(DefaultOptions().WithWidth(40)).Render(&b, markdown.Parse(body, wikiParser()))
+	assert.Equal(t, expected, b.String())
+}
+
+func TestNoBreakSpace(t *testing.T) {
+	body := []byte("The distance is about 10\u00a0km.\n")
+	expected := "The distance is about\n10\u00a0km.\n"
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(25)))
+}
+
+func TestHyphens(t *testing.T) {
+	body := []byte("This is a well-known Donau\u00addampf\u00adschiff.\n")
+	expected := `This is a well-
+known Donaudampf-
+schiff.
+`
+	assert.Equal(t, expected, renderWith(body, DefaultOptions().WithWidth(18)))
+}
+
+func TestLongWords(t *testing.T) {
+	body := []byte("See https://example.com/a/long/path for details.\n")
+	expected := `See
+https://example.com/a/long/path
+for details.
+`
+	opts := DefaultOptions().WithWidth(20)
+	assert.Equal(t, expected, renderWith(body, opts))
+	expected = `See
+https://example.com
+/a/long/path for
+details.
+`
+	opts.LongWords = Wrap
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestJustify(t *testing.T) {
+	body := []byte(`This paragraph is justified so that every line but the last one fills the width.
+
+* A list item that is justified as well.
+`)
+	expected := `This  paragraph is justified
+so  that  every line but the
+last one fills the width.
+
+* A   list   item   that  is
+  justified as well.
+`
+	opts := DefaultOptions().WithWidth(30)
+	opts.Justify = true
+	assert.Equal(t, expected, renderWith(body, opts))
+	// justified lines are as long as the longest lines that aren't justified
+	body = []byte("Justified lines end where the rule ends.\n\n---\n")
+	for _, line := range strings.Split(renderWith(body, opts), "\n") {
+		if strings.Contains(line, space+space) {
+			assert.Equal(t, opts.RuleLength, displayWidth(line))
+		}
+	}
+}
+
+func TestASCII(t *testing.T) {
+	body := []byte(`# Ærger
+
+Señor Müller said: “Crème brûlée – it’s great…” 👍 🛠️
+
+| Straße | Größe |
+|--------|-------|
+| Weg    | 5 m²  |
+
+* [x] done
+`)
+	expected := `AErger
+======
+
+Senor Mueller said: "Creme brulee - it's great..." :+1:
+:hammer_and_wrench:
+
++---------+---------+
+| STRASSE | GROESSE |
++---------+---------+
+| Weg     | 5 m2    |
++---------+---------+
+
+[x] done
+`
+	opts := DefaultOptions().WithWidth(60)
+	opts.Charset = USASCII
+	opts.TableStyle = Unicode
+	opts.Checked = "☑"
+	assert.Equal(t, expected, renderWith(body, opts))
+	// the document is unchanged and can be rendered again for another charset
+	doc := parser.New().Parse(body)
+	assert.Equal(t, expected, string(markdown.Render(doc, NewRenderer(opts))))
+	assert.Contains(t, string(markdown.Render(doc, NewRenderer(DefaultOptions()))), "Señor Müller")
+}
+
+func TestCharsetTable(t *testing.T) {
+	body := []byte(`| Größe |
+|-------|
+| 5 m²  |
+`)
+	expected := `┌───────┐
+│ GRÖßE │
+├───────┤
+│ 5 m²  │
+└───────┘
+`
+	opts := DefaultOptions()
+	opts.TableStyle = Unicode
+	opts.Charset = CP437
+	assert.Equal(t, expected, renderWith(body, opts))
+	expected = `+-------+
+| GRÖßE |
++-------+
+| 5 m²  |
++-------+
+`
+	opts.Charset = Latin1
+	assert.Equal(t, expected, renderWith(body, opts))
+}
+
+func TestImage(t *testing.T) {
+	body := []byte(`Look at this: ![A cat](cat.jpg) Nice, isn't it?
+
+![](dog.png "A dog")
+`)
+	expected := `Look at this:
+[Image: A cat] cat.jpg
+Nice, isn't it?
+
+[Image: A dog] dog.png
+`
+	assert.Equal(t, expected, render(body))
+	body = []byte("![A cat](cat.jpg) ![A dog](/pics/dog.png) ![A bird](https://example.org/bird.png)\n")
+	expected = `[Image: A cat] sub/cat.jpg
+[Image: A dog] pics/dog.png
+[Image: A bird] https://example.org/bird.png
+`
+	opts := DefaultOptions()
+	opts.Base = "sub"
+	assert.Equal(t, expected, renderWith(body, opts))
+}
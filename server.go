@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// shutdownTimeout is how long active connections are given to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// connections are the open connections, waited for on shutdown.
+var connections sync.WaitGroup
+
+// tracked are the open connections, closed on shutdown if they don't finish in time.
+var tracked = struct {
+	sync.Mutex
+	conns map[*trackingConn]bool
+}{conns: make(map[*trackingConn]bool)}
+
+// trackingListener is a listener that keeps track of open connections.
+type trackingListener struct {
+	net.Listener
+}
+
+// Accept implements net.Listener.
+func (l trackingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	connections.Add(1)
+	metrics.open(1)
+	tc := &trackingConn{Conn: c}
+	tracked.Lock()
+	tracked.conns[tc] = true
+	tracked.Unlock()
+	return tc, nil
+}
+
+// trackingConn is a connection that stops being tracked when it is closed.
+type trackingConn struct {
+	net.Conn
+	once sync.Once
+}
+
+// Close implements net.Conn.
+func (c *trackingConn) Close() error {
+	c.once.Do(func() {
+		tracked.Lock()
+		delete(tracked.conns, c)
+		tracked.Unlock()
+		metrics.open(-1)
+		connections.Done()
+	})
+	return c.Conn.Close()
+}
+
+// drain waits for the open connections to be closed. If the timeout is reached first, the remaining connections are
+// closed and the result is false.
+func drain(timeout time.Duration) bool {
+	done := make(chan bool)
+	go func() {
+		connections.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		closeAll()
+		return false
+	}
+}
+
+// closeAll closes all the open connections.
+func closeAll() {
+	tracked.Lock()
+	conns := make([]*trackingConn, 0, len(tracked.conns))
+	for c := range tracked.conns {
+		conns = append(conns, c)
+	}
+	tracked.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// logFile is the log file currently in use, if any.
+var logFile *os.File
+
+// openLog sends the log to the file, opening it again if it is already in use. This allows log rotation. An empty
+// path sends the log to standard error.
+func openLog(path string) error {
+	var f *os.File
+	if path == "" {
+		log.SetOutput(os.Stderr)
+	} else {
+		var err error
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(f)
+	}
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = f
+	return nil
+}
+
+// reload applies a new configuration. The cache is cleared and the log file is opened again. The new settings of the
+// sites are applied to the running sites with the same name. Adding or removing sites, changing their document root or
+// their listening addresses and changing the metrics address requires a restart.
+func reload(old *Config) *Config {
+	config, err := loadConfig()
+	if err != nil {
+		log.Printf("Reload failed: %s\n", err)
+		return old
+	}
+	if err := openLog(config.Log); err != nil {
+		log.Printf("Reopening the log failed: %s\n", err)
+	}
+	cache.Clear()
+	cache.Resize(config.CacheSize)
+	sites := make(map[string]*Site)
+	for _, site := range config.Sites {
+		sites[site.Name] = site
+	}
+	for _, site := range old.Sites {
+		s, ok := sites[site.Name]
+		if !ok {
+			log.Printf("Removing site %s requires a restart\n", site.Name)
+			continue
+		}
+		delete(sites, site.Name)
+		if s.Root != site.Root || !reflect.DeepEqual(s.Listen, site.Listen) {
+			log.Printf("Changing the root or the listening addresses of site %s requires a restart\n", site.Name)
+		}
+		site.update(s)
+	}
+	for name := range sites {
+		log.Printf("Adding site %s requires a restart\n", name)
+	}
+	config.Sites = old.Sites
+	if config.Metrics != old.Metrics {
+		log.Println("Changing the metrics address requires a restart")
+		config.Metrics = old.Metrics
+	}
+	log.Println("Reloaded")
+	return config
+}
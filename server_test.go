@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDrainTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer client.Close()
+	_, err = trackingListener{ln}.Accept()
+	assert.NoError(t, err)
+	// the connection is never closed by the handler, so the timeout closes it
+	assert.False(t, drain(10*time.Millisecond))
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.True(t, drain(time.Second))
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "gopher.conf")
+	t.Setenv("GOPHER_CONFIG", fp)
+	assert.NoError(t, os.WriteFile(fp, []byte(`cache-size = 0
+[site one]
+root = `+dir+`
+listen = localhost:7070
+width = 40
+`), 0644))
+	old, err := loadConfig()
+	assert.NoError(t, err)
+	site := old.Sites[0]
+	assert.NoError(t, os.WriteFile(fp, []byte(`cache-size = 0
+[site one]
+root = `+dir+`
+listen = localhost:7071
+host = gopher.example.org
+width = 50
+strict = true
+[site two]
+root = `+dir+`
+listen = localhost:7072
+`), 0644))
+	config := reload(old)
+	// the running site is changed, except for its listening address
+	assert.Equal(t, []*Site{site}, config.Sites)
+	assert.Equal(t, 50, site.Options.Width)
+	assert.Equal(t, "gopher.example.org", site.Host)
+	assert.True(t, site.Strict)
+	assert.Equal(t, []string{"localhost:7070"}, site.Listen)
+}
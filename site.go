@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Site is a document root served on one or more addresses. Sites share the cache and the log but they cannot access
+// each other's files. Host, Options, MinWidth, MaxWidth and Strict can change while the site is serving requests, see
+// Site.update.
+type Site struct {
+	Name       string   // the name in the config file
+	Root       string   // the document root
+	Host       string   // the host name advertised in menus
+	Listen     []string // the addresses to listen on
+	Options    Options  // the rendering options
+	MinWidth   int      // the smallest width a client may ask for
+	MaxWidth   int      // the largest width a client may ask for
+	Strict     bool     // text files use CRLF, dot-stuffing and the terminating period
+	real       string   // the document root with all symlinks resolved
+	ruleLength int      // the rule length set in the config file, if any
+	mu         sync.RWMutex
+}
+
+// update applies the settings of a new configuration of the site that don't require a restart.
+func (site *Site) update(config *Site) {
+	site.mu.Lock()
+	defer site.mu.Unlock()
+	site.Host = config.Host
+	site.Options = config.Options
+	site.MinWidth = config.MinWidth
+	site.MaxWidth = config.MaxWidth
+	site.Strict = config.Strict
+}
+
+// settings returns the host name advertised in menus and whether the site is strict.
+func (site *Site) settings() (string, bool) {
+	site.mu.RLock()
+	defer site.mu.RUnlock()
+	return site.Host, site.Strict
+}
+
+// request splits the selector of a request from what follows after a tab, if anything. That is either a search query
+// with the width and the charset, such as "40" or "40 ascii", or a Gopher+ representation with a width and a charset
+// parameter, such as "+text/plain;width=40;charset=us-ascii". The options returned use that width, limited to the
+// range allowed by the site, and that charset, see Charsets. The last value returned indicates a Gopher+ request.
+func (site *Site) request(s string) (string, Options, bool) {
+	selector, query, _ := strings.Cut(s, "\t")
+	query, _, _ = strings.Cut(query, "\t") // ignore the Gopher+ data flag
+	site.mu.RLock()
+	defer site.mu.RUnlock()
+	opts := site.Options
+	words := strings.Fields(query)
+	plus := strings.HasPrefix(query, "+")
+	if plus {
+		words = nil
+		params := strings.Split(query[1:], ";")
+		for _, param := range params[1:] {
+			key, v, _ := strings.Cut(param, "=")
+			switch strings.TrimSpace(key) {
+			case "width":
+				words = append(words, strings.TrimSpace(v))
+			case "charset":
+				words = append(words, strings.TrimSpace(v))
+			}
+		}
+	}
+	for _, word := range words {
+		if width, err := strconv.Atoi(word); err == nil {
+			opts = opts.WithWidth(min(max(width, site.MinWidth), site.MaxWidth))
+		} else if c, ok := charset(word); ok {
+			opts.Charset = c
+		}
+	}
+	return selector, opts, plus
+}
+
+// init makes the document root absolute and checks that it is a directory.
+func (site *Site) init() error {
+	if site.Root == "" {
+		return fmt.Errorf("site %s has no root", site.Name)
+	}
+	if len(site.Listen) == 0 {
+		return fmt.Errorf("site %s has no listen address", site.Name)
+	}
+	root, err := filepath.Abs(site.Root)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("site %s: %s is not a directory", site.Name, site.Root)
+	}
+	site.Root = root
+	site.real = real
+	return nil
+}
+
+// contains reports whether the file is inside the document root once all symlinks are resolved.
+func (site *Site) contains(fp string) bool {
+	real, err := filepath.EvalSymlinks(fp)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(site.real, real)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"git.mills.io/prologic/go-gopher"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testResponseWriter collects the response in a string.
+type testResponseWriter struct {
+	strings.Builder
+}
+
+func (w *testResponseWriter) Server() *gopher.Server         { return nil }
+func (w *testResponseWriter) End() error                     { return nil }
+func (w *testResponseWriter) WriteError(err string) error    { return nil }
+func (w *testResponseWriter) WriteInfo(msg string) error     { return nil }
+func (w *testResponseWriter) WriteItem(i *gopher.Item) error { return nil }
+
+// testSite returns a site for a new directory with the given files.
+func testSite(t *testing.T, files map[string]string) *Site {
+	dir := t.TempDir()
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		assert.NoError(t, os.WriteFile(fp, []byte(content), 0644))
+	}
+	site := &Site{Name: "test", Root: dir, Listen: []string{"localhost:7070"}, Options: DefaultOptions(),
+		MinWidth: 20, MaxWidth: 100}
+	assert.NoError(t, site.init())
+	return site
+}
+
+// get returns the response of the site for the selector.
+func get(site *Site, selector string) string {
+	w := &testResponseWriter{}
+	site.ServeGopher(w, &gopher.Request{Selector: selector, LocalHost: "localhost", LocalPort: 7070})
+	return w.String()
+}
+
+func TestSitePage(t *testing.T) {
+	site := testSite(t, map[string]string{"a.md": "# A\n"})
+	assert.Equal(t, "A\n=\n", get(site, "/a"))
+	assert.Equal(t, "# A\n", get(site, "/a.md"))
+}
+
+func TestSiteMenu(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"index.md":  "* [A](a)\n* [B](sub/b)\n",
+		"sub/b.md":  "# B\n",
+		"sub/c.md":  "# C\n",
+		"sub/c.jpg": "",
+	})
+	assert.Equal(t, "0A\ta\tlocalhost\t7070\r\n0B\tsub/b\tlocalhost\t7070\r\n.\r\n", get(site, "/"))
+	assert.Equal(t, "0b\tsub/b\tlocalhost\t7070\r\n0c\tsub/c\tlocalhost\t7070\r\n.\r\n", get(site, "/sub"))
+}
+
+func TestSiteASCII(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"index.md": "* [Café “Müller”](a)\n",
+		"a.md":     "# Über\n\nCafé — 5 € …\n",
+	})
+	assert.Equal(t, "0Café “Müller”\ta\tlocalhost\t7070\r\n.\r\n", get(site, "/"))
+	assert.Equal(t, "0Cafe \"Mueller\"\ta\tlocalhost\t7070\r\n.\r\n", get(site, "/\tascii"))
+	assert.Equal(t, "Ueber\n=====\n\nCafe -- 5 EUR ...\n", get(site, "/a\t40 ascii"))
+	assert.Equal(t, "+-2\r\nUeber\n=====\n\nCafe -- 5 EUR ...\n", get(site, "/a\t+text/plain;charset=us-ascii\t1"))
+	assert.Equal(t, "0Ueber\ta\tlocalhost\t7070\r\n.\r\n", get(site, "/a/\tascii"))
+	site.Options.Charset = USASCII
+	assert.Equal(t, "Ueber\n=====\n\nCafe -- 5 EUR ...\n", get(site, "/a"))
+}
+
+func TestSiteCharset(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"a.md": "\ufeffCafé — 5 € …\n",
+		"b.md": "Caf\xe9 \x96 5 \x80\n",
+	})
+	assert.Equal(t, "Café — 5 € …\n", get(site, "/a"))
+	assert.Equal(t, "Café – 5 €\n", get(site, "/b"))
+	assert.Equal(t, "Caf\xe9 -- 5 EUR ...\n", get(site, "/a\tlatin1"))
+	assert.Equal(t, "Caf\x82 -- 5 EUR ...\n", get(site, "/a\t+text/plain;charset=ibm437\t1")[5:])
+	site.Options.Charset = Latin1
+	assert.Equal(t, "Caf\xe9 - 5 EUR\n", get(site, "/b"))
+}
+
+func TestSiteIsolation(t *testing.T) {
+	other := testSite(t, map[string]string{"secret.md": "# Secret\n"})
+	site := testSite(t, map[string]string{"a.md": "# A\n"})
+	rel, err := filepath.Rel(site.Root, other.Root)
+	assert.NoError(t, err)
+	assert.Equal(t, "no info available\r\n", get(site, "/"+filepath.ToSlash(rel)+"/secret"))
+	assert.NoError(t, os.Symlink(filepath.Join(other.Root, "secret.md"), filepath.Join(site.Root, "link.md")))
+	assert.Equal(t, "no info available\r\n", get(site, "/link"))
+	assert.NoError(t, os.Symlink("a.md", filepath.Join(site.Root, "b.md")))
+	assert.Equal(t, "A\n=\n", get(site, "/b"))
+}
+
+func TestSiteWidth(t *testing.T) {
+	text := strings.Repeat("This is text. ", 6)
+	site := testSite(t, map[string]string{"a.md": text + "\n\n----\n"})
+	assert.Equal(t, `This is text. This is text. This is text. This is text. This is text.
+This is text.
+
+----------------------------------------------------------------------
+`, get(site, "/a"))
+	assert.Equal(t, `This is text. This is
+text. This is text. This
+is text. This is text.
+This is text.
+
+--------------------------
+`, get(site, "/a\t28"))
+	assert.Equal(t, "+-2\r\n"+`This is text. This is
+text. This is text. This
+is text. This is text.
+This is text.
+
+--------------------------
+`, get(site, "/a\t+text/plain;width=28\t1"))
+	assert.Equal(t, "--2\r\n1 Item is not available.\r\n", get(site, "/b\t+text/plain;width=28\t1"))
+	// too narrow
+	assert.Equal(t, `This is text. This
+is text. This is
+text. This is
+text. This is
+text. This is
+text.
+
+------------------
+`, get(site, "/a\t5"))
+}
+
+func TestSiteStrict(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"a.md":  "# A\n\n.dot\n",
+		"b.txt": ".b\nc",
+		"c.png": "\x89PNG\r\n\x1a\n",
+	})
+	site.Strict = true
+	assert.Equal(t, "A\r\n=\r\n\r\n..dot\r\n.\r\n", get(site, "/a"))
+	assert.Equal(t, "# A\r\n\r\n..dot\r\n.\r\n", get(site, "/a.md"))
+	assert.Equal(t, "..b\r\nc\r\n.\r\n", get(site, "/b.txt"))
+	assert.Equal(t, "\x89PNG\r\n\x1a\n", get(site, "/c.png"))
+	assert.Equal(t, "+-1\r\nA\r\n=\r\n\r\n..dot\r\n.\r\n", get(site, "/a\t+"))
+}
+
+func TestSiteContents(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"a.md": "# A\n\n## B c\n\n### D\n\n## B c\n",
+	})
+	assert.Equal(t, "0A\ta\tlocalhost\t7070\r\n"+
+		"0B c\ta/b-c\tlocalhost\t7070\r\n"+
+		"0  D\ta/d\tlocalhost\t7070\r\n"+
+		"0B c\ta/b-c-1\tlocalhost\t7070\r\n"+
+		".\r\n", get(site, "a/"))
+}
+
+func TestSiteSection(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"a.md":   "# A\n\nText.\n\n## B\n\nB text.\n\n## C\n\nC text.\n",
+		"a/c.md": "Not a section.\n",
+	})
+	misses := cache.Stats().Misses
+	assert.Equal(t, "B\n-\n\nB text.\n", get(site, "a#b"))
+	assert.Equal(t, "B\n-\n\nB text.\n", get(site, "a/b"))
+	assert.Equal(t, "Not a section.\n", get(site, "a/c"))
+	assert.Equal(t, "C\n-\n\nC text.\n", get(site, "a#c"))
+	assert.Equal(t, "no info available\r\n", get(site, "a#d"))
+	assert.Equal(t, "no info available\r\n", get(site, "a/d"))
+	fp := filepath.Join(site.Root, "a.md")
+	fi, err := os.Stat(fp)
+	assert.NoError(t, err)
+	sections.Lock()
+	page := sections.pages[fp]
+	sections.Unlock()
+	assert.Equal(t, fi.ModTime(), page.mtime)
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "c": true}, page.ids)
+	// only the four pages rendered count as cache misses
+	assert.Equal(t, misses+4, cache.Stats().Misses)
+}
+
+func TestSiteMenuImages(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"index.md": "* ![A cat](cat.jpg)\n* ![](dog.gif \"A dog\")\n* ![A bird](https://example.org/bird.png)\n",
+		"sub/p.md": "![A cat](cat.jpg)\n",
+	})
+	assert.Equal(t, "[Image: A cat] sub/cat.jpg\n", get(site, "/sub/p"))
+	assert.Equal(t, "IA cat\tcat.jpg\tlocalhost\t7070\r\n"+
+		"gA dog\tdog.gif\tlocalhost\t7070\r\n"+
+		"hA bird\tURL:https://example.org/bird.png\tlocalhost\t7070\r\n"+
+		".\r\n", get(site, "/"))
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/olekukonko/tablewriter"
+	"io"
+	"strings"
+)
+
+// Table styles.
+const (
+	ASCII   = "ascii"   // borders drawn with "+", "-" and "|"
+	Unicode = "unicode" // borders drawn with box drawing characters
+	Minimal = "minimal" // no borders, only a line below the header
+)
+
+// TableStyles are all the table styles.
+var TableStyles = []string{ASCII, Unicode, Minimal}
+
+// maxTableSize is the number of bytes of cell text kept for a table. The cells of a table are kept until the end of the
+// table because the width of the columns depends on all of them. A table with more text than this is written as a list
+// of records instead, each row as soon as it is complete.
+var maxTableSize = 1 << 20
+
+// table collects the cells of a table. The table can only be written once all the cells are known, unless it is too
+// big, see maxTableSize.
+type table struct {
+	header    []string
+	footer    []string
+	rows      [][]string
+	align     []ast.CellAlignFlags // the alignment of each column
+	row       []string             // the current row
+	part      ast.Node             // the current part: header, body or footer
+	cell      bytes.Buffer         // the text of the current cell while it is rendered
+	size      int                  // the number of bytes of cell text kept
+	streaming bool                 // the table is written as records, row by row
+	records   int                  // the number of records written
+}
+
+// addCell adds a cell to the current row. The alignment of the first row determines the alignment of the columns.
+func (t *table) addCell(text string, align ast.CellAlignFlags) {
+	if len(t.row) >= len(t.align) {
+		t.align = append(t.align, align)
+	}
+	t.row = append(t.row, text)
+	t.size += len(text)
+}
+
+// endRow adds the current row to the current part of the table.
+func (t *table) endRow() {
+	switch t.part.(type) {
+	case *ast.TableHeader:
+		t.header = t.row
+	case *ast.TableFooter:
+		t.footer = t.row
+	default:
+		t.rows = append(t.rows, t.row)
+	}
+	t.row = nil
+}
+
+// renderTable writes the table. The columns are as wide as their widest cell, if possible. Otherwise, the widest
+// columns are made narrower and their cells are wrapped. If the columns cannot be made narrow enough without breaking
+// words, the table is written as a list of records instead.
+func (r Renderer) renderTable(w io.Writer, t *table) {
+	all := append([][]string{t.header, t.footer}, t.rows...)
+	n := len(t.align)
+	natural := make([]int, n)
+	minimum := make([]int, n)
+	for _, row := range all {
+		for i, cell := range row {
+			natural[i] = max(natural[i], displayWidth(cell))
+			for _, word := range fields(cell) {
+				for _, unit := range units(word) {
+					minimum[i] = max(minimum[i], displayWidth(unit))
+				}
+			}
+		}
+	}
+	overhead := 3*n + 1
+	if r.opts.TableStyle == Minimal {
+		overhead = 2 * (n - 1)
+	}
+	available := r.buf.max - r.buf.prefixWidth() - overhead
+	widths := natural
+	for sum(widths) > available {
+		// narrow the widest column that can still be narrowed
+		i := -1
+		for j := range widths {
+			if widths[j] > minimum[j] && (i < 0 || widths[j] > widths[i]) {
+				i = j
+			}
+		}
+		if i < 0 {
+			r.records(w, t)
+			return
+		}
+		widths[i]--
+	}
+	// wrap the cells and determine the widths actually used
+	limits := widths
+	widths = make([]int, n)
+	wrap := func(row []string) []string {
+		result := make([]string, len(row))
+		for i, cell := range row {
+			wrapped := lines(cell, limits[i]+2)
+			for _, line := range wrapped {
+				widths[i] = max(widths[i], displayWidth(line))
+			}
+			result[i] = strings.Join(wrapped, "\n")
+		}
+		return result
+	}
+	header := wrap(t.header)
+	footer := wrap(t.footer)
+	rows := make([][]string, len(t.rows))
+	for i, row := range t.rows {
+		rows[i] = wrap(row)
+	}
+	lw := &tableLines{r: r, w: w}
+	tw := tablewriter.NewWriter(lw)
+	tw.SetNewLine("\n")
+	tw.SetAutoWrapText(false)
+	alignments := make([]int, n)
+	for i, align := range t.align {
+		switch align {
+		case ast.TableAlignmentLeft:
+			alignments[i] = tablewriter.ALIGN_LEFT
+		case ast.TableAlignmentRight:
+			alignments[i] = tablewriter.ALIGN_RIGHT
+		case ast.TableAlignmentCenter:
+			alignments[i] = tablewriter.ALIGN_CENTER
+		}
+	}
+	tw.SetColumnAlignment(alignments)
+	switch r.opts.TableStyle {
+	case Unicode:
+		tw.SetCenterSeparator("┼")
+		tw.SetColumnSeparator("│")
+		tw.SetRowSeparator("─")
+	case Minimal:
+		tw.SetBorder(false)
+		tw.SetNoWhiteSpace(true)
+		tw.SetTablePadding(space + space)
+		tw.SetHeaderLine(false)
+	}
+	if t.header != nil {
+		tw.SetHeader(header)
+	}
+	if t.footer != nil {
+		tw.SetFooter(footer)
+	}
+	tw.AppendBulk(rows)
+	if r.opts.TableStyle == Minimal && t.header != nil {
+		// underline the header
+		for _, cell := range header {
+			lw.height = max(lw.height, strings.Count(cell, "\n")+1)
+		}
+		dashes := make([]string, n)
+		for i, width := range widths {
+			dashes[i] = strings.Repeat("-", width)
+		}
+		lw.underline = strings.Join(dashes, space+space)
+	}
+	tw.Render()
+	lw.close()
+}
+
+// tableLines writes the lines of a table as they are produced by the tablewriter. The last line is held back until
+// the next one arrives so that the bottom line of a table drawn with box drawing characters gets its corners.
+type tableLines struct {
+	r         Renderer
+	w         io.Writer
+	partial   []byte  // the beginning of the next line
+	held      *string // the last complete line
+	n         int     // the number of lines written
+	height    int     // the number of lines of the header
+	underline string  // the line after the header, if any
+}
+
+// Write implements io.Writer.
+func (lw *tableLines) Write(p []byte) (int, error) {
+	lw.partial = append(lw.partial, p...)
+	for {
+		i := bytes.IndexByte(lw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(lw.partial[:i])
+		lw.partial = lw.partial[i+1:]
+		if lw.held != nil {
+			lw.writeLine(*lw.held, false)
+		}
+		lw.held = &line
+	}
+	return len(p), nil
+}
+
+// close writes the last line.
+func (lw *tableLines) close() {
+	if lw.held != nil {
+		lw.writeLine(*lw.held, true)
+		lw.held = nil
+	}
+}
+
+// writeLine writes a line of the table, followed by the underline of the header, if required.
+func (lw *tableLines) writeLine(line string, bottom bool) {
+	if lw.r.opts.TableStyle == Unicode {
+		line = corners(line, lw.n == 0, bottom)
+	}
+	lw.r.buf.writeLine(lw.w, line)
+	lw.n++
+	if lw.n == lw.height && lw.underline != "" {
+		lw.r.buf.writeLine(lw.w, lw.underline)
+	}
+}
+
+// corners replaces the crossings at the ends of a horizontal line in a table drawn with box drawing characters. The
+// top and the bottom line also get their own crossings.
+func corners(line string, top, bottom bool) string {
+	if strings.Trim(line, "─┼") != "" {
+		return line
+	}
+	left, center, right := "├", "┼", "┤"
+	if top {
+		left, center, right = "┌", "┬", "┐"
+	} else if bottom {
+		left, center, right = "└", "┴", "┘"
+	}
+	line = strings.ReplaceAll(line, "┼", center)
+	line = strings.Replace(line, center, left, 1)
+	if i := strings.LastIndex(line, center); i >= 0 {
+		line = line[:i] + right + line[i+len(center):]
+	}
+	return line
+}
+
+// records writes the rows kept so far and the footer as a list of records, one for each row. Each cell is prefixed with
+// its column header. The rows written are no longer kept.
+func (r Renderer) records(w io.Writer, t *table) {
+	rows := t.rows
+	if t.footer != nil {
+		rows = append(rows, t.footer)
+	}
+	t.rows, t.footer, t.size = nil, nil, 0
+	for _, row := range rows {
+		if t.records > 0 {
+			r.paragraphSeparator(w)
+		}
+		t.records++
+		for j, cell := range row {
+			label := fmt.Sprint(j + 1)
+			if j < len(t.header) && t.header[j] != "" {
+				label = t.header[j]
+			}
+			r.buf.pushPrefix(label+":"+space, strings.Repeat(space, r.opts.Indent))
+			r.buf.writePrefix()
+			r.buf.writeWords(w, cell)
+			r.buf.newline(w)
+			r.buf.popPrefix()
+		}
+	}
+}
+
+// sum returns the sum of the numbers.
+func sum(numbers []int) int {
+	result := 0
+	for _, n := range numbers {
+		result += n
+	}
+	return result
+}
+
+// validTableStyle returns an error unless the style is one of the TableStyles.
+func validTableStyle(style string) error {
+	for _, s := range TableStyles {
+		if s == style {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown table style %s, use one of %s", style, strings.Join(TableStyles, ", "))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"git.mills.io/prologic/go-gopher"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// typeOf returns the Gopher item type of a file based on its extension or, if the extension is unknown, its first
+// bytes. Unlike gopher.GetItemType, the file is closed again.
+func typeOf(fp string) gopher.ItemType {
+	if t, ok := gopher.FileExtensions[strings.ToLower(filepath.Ext(fp))]; ok {
+		return t
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return gopher.BINARY
+	}
+	defer f.Close()
+	b := make([]byte, 512)
+	n, _ := io.ReadFull(f, b)
+	mimeType, _, _ := strings.Cut(http.DetectContentType(b[:n]), ";")
+	switch {
+	case mimeType == "text/html":
+		return gopher.HTML
+	case strings.HasPrefix(mimeType, "text/"):
+		return gopher.FILE
+	case mimeType == "image/gif":
+		return gopher.GIF
+	case strings.HasPrefix(mimeType, "image/"):
+		return gopher.IMAGE
+	case strings.HasPrefix(mimeType, "audio/"):
+		return gopher.AUDIO
+	}
+	return gopher.BINARY
+}
+
+// textWriter writes text the way RFC 1436 wants it: lines end with CRLF, lines starting with a period get a second
+// period, and Close adds a period on a line by itself.
+type textWriter struct {
+	w   io.Writer
+	buf []byte
+	bol bool // at the beginning of a line
+	cr  bool // the last byte was a carriage return
+}
+
+// newTextWriter returns a new textWriter.
+func newTextWriter(w io.Writer) *textWriter {
+	return &textWriter{w: w, bol: true}
+}
+
+// Write implements io.Writer.
+func (t *textWriter) Write(p []byte) (int, error) {
+	t.buf = t.buf[:0]
+	for _, c := range p {
+		if t.bol && c == '.' {
+			t.buf = append(t.buf, '.')
+		}
+		if c == '\n' && !t.cr {
+			t.buf = append(t.buf, '\r')
+		}
+		t.buf = append(t.buf, c)
+		t.cr = c == '\r'
+		t.bol = c == '\n'
+	}
+	_, err := t.w.Write(t.buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close ends the last line, if necessary, and writes the terminating period. It does not close the underlying
+// writer.
+func (t *textWriter) Close() error {
+	s := ".\r\n"
+	if !t.bol {
+		s = "\r\n" + s
+	}
+	_, err := io.WriteString(t.w, s)
+	return err
+}
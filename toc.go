@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"git.mills.io/prologic/go-gopher"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// isTOCMarker reports whether the paragraph consists of nothing but the [[_TOC_]] marker. With the wiki parser, the
+// marker is a link. Otherwise, it is text; the underscores might be parsed as emphasis.
+func isTOCMarker(node *ast.Paragraph) bool {
+	var children []ast.Node
+	for _, child := range node.GetChildren() {
+		if text, ok := child.(*ast.Text); !ok || strings.TrimSpace(string(text.Literal)) != "" {
+			children = append(children, child)
+		}
+	}
+	if len(children) == 1 {
+		if link, ok := children[0].(*ast.Link); ok {
+			return string(link.Destination) == "_TOC_"
+		}
+	}
+	text := strings.TrimSpace(plainText(node))
+	return text == "[[_TOC_]]" || text == "[[TOC]]"
+}
+
+// hasTOCMarker reports whether the document contains the [[_TOC_]] marker.
+func hasTOCMarker(doc ast.Node) bool {
+	found := false
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if p, ok := node.(*ast.Paragraph); ok && entering && isTOCMarker(p) {
+			found = true
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return found
+}
+
+// topLevel returns the highest level of the headings in the table of contents, or 1 if there are none.
+func (r Renderer) topLevel() int {
+	if len(r.buf.headings) == 0 {
+		return 1
+	}
+	top := 6
+	for _, heading := range r.buf.headings {
+		top = min(top, heading.Level)
+	}
+	return top
+}
+
+// toc writes the table of contents, if there are any headings: a heading using the title and one line per heading,
+// indented according to its level, with its number if sections are numbered or with a bullet otherwise.
+func (r Renderer) toc(w io.Writer) {
+	if len(r.buf.headings) == 0 {
+		return
+	}
+	top := r.topLevel()
+	r.paragraphSeparator(w)
+	r.writeHeading(w, r.opts.TOCTitle, top)
+	r.paragraphSeparator(w)
+	for _, heading := range r.buf.headings {
+		indent := strings.Repeat(space, r.opts.Indent*(heading.Level-top))
+		marker := r.opts.Bullet
+		if r.opts.NumberHeadings {
+			marker = r.buf.numbers[heading]
+		}
+		r.buf.pushListPrefix(indent+marker+space, 0)
+		r.buf.writeWords(w, transliterate(strings.Join(fields(plainText(heading)), space), r.opts.Charset))
+		r.buf.newline(w)
+		r.buf.popPrefix()
+	}
+}
+
+// contents writes a menu for the table of contents of a page. The first item links to the whole page. The other
+// items link to the sections of the page: the selector of the page, a slash, and the heading ID.
+func contents(w io.Writer, r *gopher.Request, fp, selector string, opts Options) error {
+	md, err := readMarkdown(fp + ".md")
+	if err != nil {
+		return err
+	}
+	doc := markdown.Parse(md, wikiParser())
+	renderer := NewRenderer(opts)
+	renderer.initSections(doc)
+	title := selector
+	if heading := firstHeading(doc); heading != nil {
+		title = strings.Join(fields(plainText(heading)), space)
+	}
+	fmt.Fprintf(w, "0%s\t%s\t%s\t%d\r\n", menuText(title, opts), selector, r.LocalHost, r.LocalPort)
+	top := renderer.topLevel()
+	for _, heading := range renderer.buf.headings {
+		indent := strings.Repeat(space, opts.Indent*(heading.Level-top))
+		fmt.Fprintf(w, "0%s%s\t%s/%s\t%s\t%d\r\n", indent, menuText(renderer.headingText(heading), opts), selector,
+			headingID(heading), r.LocalHost, r.LocalPort)
+	}
+	return nil
+}
+
+// firstHeading returns the first heading of the document, if any.
+func firstHeading(doc ast.Node) *ast.Heading {
+	var result *ast.Heading
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok {
+			result = heading
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return result
+}
+
+// sectionNodes returns the top level nodes of the section with the heading ID: the heading and everything up to the
+// next heading of the same or a higher level. If there is no such heading, the result is empty but not nil.
+func sectionNodes(doc ast.Node, id string) map[ast.Node]bool {
+	result := make(map[ast.Node]bool)
+	level := 0
+	for _, node := range doc.GetChildren() {
+		heading, ok := node.(*ast.Heading)
+		if level == 0 {
+			if !ok || headingID(heading) != id {
+				continue
+			}
+			level = heading.Level
+		} else if ok && heading.Level <= level {
+			break
+		}
+		result[node] = true
+	}
+	return result
+}
+
+// maxSectionPages is the number of pages whose section IDs are kept. If there are more, all of them are dropped.
+const maxSectionPages = 1000
+
+// sections are the heading IDs of the sections of pages, by the path of the Markdown file. They are kept apart from
+// the cache of rendered pages so that they neither count as cache hits nor use its budget.
+var sections = struct {
+	sync.Mutex
+	pages map[string]sectionIDs
+}{pages: make(map[string]sectionIDs)}
+
+// sectionIDs are the heading IDs of the sections of a page, and the modification time and the size of the file they
+// were taken from.
+type sectionIDs struct {
+	mtime time.Time
+	size  int64
+	ids   map[string]bool
+}
+
+// hasSection reports whether the page has a section with the heading ID. The IDs of the sections are kept so that the
+// page is only parsed once per change to check for sections.
+func hasSection(fp, id string) bool {
+	fi, err := os.Stat(fp + ".md")
+	if err != nil {
+		return false
+	}
+	sections.Lock()
+	page, ok := sections.pages[fp+".md"]
+	sections.Unlock()
+	if !ok || !page.mtime.Equal(fi.ModTime()) || page.size != fi.Size() {
+		md, err := readMarkdown(fp + ".md")
+		if err != nil {
+			return false
+		}
+		page = sectionIDs{mtime: fi.ModTime(), size: fi.Size(), ids: make(map[string]bool)}
+		for _, node := range markdown.Parse(md, wikiParser()).GetChildren() {
+			if heading, ok := node.(*ast.Heading); ok {
+				page.ids[headingID(heading)] = true
+			}
+		}
+		sections.Lock()
+		if len(sections.pages) >= maxSectionPages {
+			sections.pages = make(map[string]sectionIDs)
+		}
+		sections.pages[fp+".md"] = page
+		sections.Unlock()
+	}
+	return page.ids[id]
+}
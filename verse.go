@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/gomarkdown/markdown/ast"
+	"io"
+	"strings"
+)
+
+// verseClass is the class that turns a paragraph into verse, e.g. "{.verse}" on the line before the paragraph. On a
+// block quote or a list, it applies to all the paragraphs in it.
+const verseClass = "verse"
+
+// isVerse reports whether the node or one of its parents has the verse class.
+func isVerse(node ast.Node) bool {
+	for ; node != nil; node = node.GetParent() {
+		var attr *ast.Attribute
+		if c := node.AsContainer(); c != nil {
+			attr = c.Attribute
+		} else if l := node.AsLeaf(); l != nil {
+			attr = l.Attribute
+		}
+		if attr == nil {
+			continue
+		}
+		for _, class := range attr.Classes {
+			if string(class) == verseClass {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lineBreak ends the current line, even if it is empty. In verse, the next line starts without the hanging indent.
+func (r Renderer) lineBreak(w io.Writer) {
+	r.buf.writePrefix()
+	r.buf.newline(w)
+	if r.buf.verse {
+		r.buf.frames[len(r.buf.frames)-1].used = false
+	}
+}
+
+// writeVerse writes text and keeps its line breaks.
+func (r Renderer) writeVerse(w io.Writer, text string) {
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			r.lineBreak(w)
+		}
+		r.buf.writeWords(w, line)
+	}
+}
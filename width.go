@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mattn/go-runewidth"
+	"strings"
+	"unicode"
+)
+
+// widthCondition treats characters of ambiguous width as narrow, regardless of the locale of the server.
+var widthCondition = &runewidth.Condition{EastAsianWidth: false}
+
+const (
+	zeroWidthJoiner = '\u200d'
+	emojiSelector   = '\ufe0f'
+)
+
+// softHyphen marks where a word may be hyphenated. It is only shown where a line is broken.
+const softHyphen = "\u00ad"
+
+// noBreakSpaces are the spaces that must not be used to break a line: the no-break space, the figure space and the
+// narrow no-break space.
+const noBreakSpaces = "\u00a0\u2007\u202f"
+
+// noBreakBefore are closing punctuation characters that must not start a line.
+const noBreakBefore = "、。，．・：；？！ー）」』】〕〉》〙〗｝］…‥ゝゞヽヾぁぃぅぇぉっゃゅょァィゥェォッャュョ"
+
+// noBreakAfter are opening punctuation characters that must not end a line.
+const noBreakAfter = "（「『【〔〈《〘〖｛［"
+
+// runeWidth returns the number of terminal columns a character needs on its own. Combining marks and format
+// characters such as the zero width space and the soft hyphen need none; East Asian wide characters need two.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	return widthCondition.RuneWidth(r)
+}
+
+// displayWidth returns the number of terminal columns a string needs. A character joined to the previous one by a
+// zero width joiner needs no extra columns, so that an emoji sequence counts as a single emoji. The emoji variation
+// selector makes a narrow character wide.
+func displayWidth(s string) int {
+	width := 0
+	last := 0 // width of the last character
+	joined := false
+	for _, r := range s {
+		switch {
+		case r == zeroWidthJoiner:
+			joined = true
+		case joined:
+			joined = false
+		case r == emojiSelector:
+			if last == 1 {
+				width++
+				last = 2
+			}
+		default:
+			last = runeWidth(r)
+			width += last
+		}
+	}
+	return width
+}
+
+// isSpace reports whether the character is whitespace at which a line may be broken.
+func isSpace(r rune) bool {
+	return unicode.IsSpace(r) && !strings.ContainsRune(noBreakSpaces, r)
+}
+
+// fields splits the text into words at whitespace, except at no-break spaces.
+func fields(text string) []string {
+	return strings.FieldsFunc(text, isSpace)
+}
+
+// units splits a word into the parts between which a line may be broken. Between wide characters, as used by
+// Chinese and Japanese, a line may be broken without a space. Every wide character is therefore a unit of its own,
+// together with the characters that must stay with it: combining marks, joined characters, closing punctuation
+// following it and opening punctuation preceding it. Runs of other characters stay together, except that a line may
+// also be broken after a soft hyphen and after a hyphen between letters.
+func units(word string) []string {
+	var result []string
+	start := 0
+	prev, beforePrev := rune(0), rune(0)
+	prevWide := false
+	joined := false
+	for i, r := range word {
+		w := runeWidth(r)
+		attached := w == 0 || joined || r == emojiSelector || strings.ContainsRune(noBreakBefore, r)
+		joined = r == zeroWidthJoiner
+		wide := (w == 2 || prevWide) && !strings.ContainsRune(noBreakAfter, prev)
+		hyphen := string(prev) == softHyphen || prev == '-' && unicode.IsLetter(beforePrev) && unicode.IsLetter(r)
+		if i > start && !attached && (wide || hyphen) {
+			result = append(result, word[start:i])
+			start = i
+		}
+		if !attached {
+			prevWide = w == 2
+		}
+		prev, beforePrev = r, prev
+	}
+	return append(result, word[start:])
+}
+
+// cut splits a string after the given number of terminal columns. Characters that need no columns stay with the
+// preceding character.
+func cut(s string, width int) (string, string) {
+	used := 0
+	for i, r := range s {
+		w := runeWidth(r)
+		if used+w > width {
+			return s[:i], s[i:]
+		}
+		used += w
+	}
+	return s, ""
+}
+
+// LongWordPolicies are all the policies for words and URLs longer than a line: Keep lets them stick out of the line,
+// Wrap breaks them.
+var LongWordPolicies = []string{Keep, Wrap}
+
+// validLongWords returns an error unless the policy is one of the LongWordPolicies.
+func validLongWords(policy string) error {
+	for _, p := range LongWordPolicies {
+		if p == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %s, use one of %s", policy, strings.Join(LongWordPolicies, ", "))
+}
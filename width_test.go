@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	assert.Equal(t, 9, displayWidth("Überblick"))
+	assert.Equal(t, 9, displayWidth("U\u0308berblick"))
+	assert.Equal(t, 4, displayWidth("日本"))
+	assert.Equal(t, 4, displayWidth("\u200b#tag"))
+	assert.Equal(t, 2, displayWidth("👨\u200d👩\u200d👧"))
+	assert.Equal(t, 2, displayWidth("🛠\ufe0f"))
+}
+
+func TestUnits(t *testing.T) {
+	assert.Equal(t, []string{"word"}, units("word"))
+	assert.Equal(t, []string{"日", "本", "語"}, units("日本語"))
+	assert.Equal(t, []string{"こ", "れ", "は", "「本」", "で", "す。"}, units("これは「本」です。"))
+	assert.Equal(t, []string{"Go", "言", "語"}, units("Go言語"))
+	assert.Equal(t, []string{"well-", "known"}, units("well-known"))
+	assert.Equal(t, []string{"-5", "--"}, []string{units("-5")[0], units("--")[0]})
+	assert.Equal(t, []string{"Donau\u00ad", "dampf\u00ad", "schiff"}, units("Donau\u00addampf\u00adschiff"))
+}
+
+func TestFields(t *testing.T) {
+	assert.Equal(t, []string{"10\u00a0km", "away"}, fields("10\u00a0km away"))
+}